@@ -0,0 +1,350 @@
+package catscraper
+
+import (
+	"cat-scraper/internal/imgfinder"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// A Finder downloads memes as its options say. It can download many times.
+type Finder struct {
+	quotas       []imgfinder.SiteQuota
+	imageHosts   []string
+	output       string
+	fileSystem   FileSystem
+	client       *http.Client
+	threads      int
+	filter       Filter
+	observers    []Observer
+	nameTemplate string
+	onConflict   imgfinder.ConflictPolicy
+	manifest     bool
+	log          io.Writer
+}
+
+// An Option configures a Finder
+type Option func(f *Finder) error
+
+// New returns a finder with the given options. Without them, it downloads 10
+// memes from I Can Has Cheezburger to images/ with a single download at a
+// time, recording them in a manifest, and without logging.
+func New(options ...Option) (*Finder, error) {
+	finder := &Finder{
+		output:       "images/",
+		threads:      1,
+		nameTemplate: imgfinder.DefaultNameTemplate,
+		onConflict:   imgfinder.ConflictOverwrite,
+		manifest:     true,
+		log:          io.Discard,
+	}
+
+	for _, option := range options {
+		err := option(finder)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(finder.quotas) == 0 {
+		finder.quotas = []imgfinder.SiteQuota{{Site: imgfinder.DefaultSite, Amount: 10}}
+	}
+
+	return finder, nil
+}
+
+// WithSite makes the finder download amount memes from a site, either a known
+// name like memebase or a URL. It can be used many times to download from many
+// sites, and memes found in more than one are only downloaded once.
+func WithSite(site string, amount int) Option {
+	return func(f *Finder) error {
+		parsed, err := imgfinder.ParseSite(site)
+		if err != nil {
+			return err
+		}
+
+		if amount < 1 {
+			return fmt.Errorf("invalid amount %d of %s, expected 1 or more", amount, site)
+		}
+
+		f.quotas = append(f.quotas, imgfinder.SiteQuota{Site: parsed, Amount: amount})
+		return nil
+	}
+}
+
+// WithImageHosts makes the finder only download memes from hosts, e.g. to
+// scrap a fake site. Without it, memes are downloaded from Cheezburger's CDN.
+func WithImageHosts(hosts ...string) Option {
+	return func(f *Finder) error {
+		f.imageHosts = hosts
+		return nil
+	}
+}
+
+// WithOutput makes the finder save memes to a local directory or an
+// s3://bucket/prefix location
+func WithOutput(location string) Option {
+	return func(f *Finder) error {
+		if location == "" {
+			return fmt.Errorf("invalid empty output, expected a directory or s3://bucket/prefix")
+		}
+
+		f.output = location
+		return nil
+	}
+}
+
+// A FileSystem is where memes are saved. Missing files are reported with
+// errors wrapping fs.ErrNotExist. catscrapertest has an in-memory one for
+// tests.
+type FileSystem interface {
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	MkdirAll(name string, perm os.FileMode) error
+	ReadFile(name string) ([]byte, error)
+	Stat(name string) (os.FileInfo, error)
+	Exists(name string) (bool, error)
+	Remove(name string) error
+	ReadDir(name string) ([]os.DirEntry, error)
+}
+
+// WithFileSystem makes the finder save memes to fileSystem instead of the
+// local disk or S3. The output is then a directory of fileSystem.
+func WithFileSystem(fileSystem FileSystem) Option {
+	return func(f *Finder) error {
+		f.fileSystem = fileSystem
+		return nil
+	}
+}
+
+// WithHTTPClient makes the finder request pages and memes, and upload to S3,
+// with client. Its transport and timeout are used for all of them. Without
+// it, requests time out as the command line's do.
+func WithHTTPClient(client *http.Client) Option {
+	return func(f *Finder) error {
+		f.client = client
+		return nil
+	}
+}
+
+// WithConcurrency makes the finder download up to threads memes at a time
+func WithConcurrency(threads int) Option {
+	return func(f *Finder) error {
+		if threads < 1 {
+			return fmt.Errorf("invalid concurrency %d, expected 1 or more", threads)
+		}
+
+		f.threads = threads
+		return nil
+	}
+}
+
+// WithFilter makes the finder only save memes that pass filter
+func WithFilter(filter Filter) Option {
+	return func(f *Finder) error {
+		// Checked now so invalid filters fail early
+		_, err := filter.internal()
+		if err != nil {
+			return err
+		}
+
+		f.filter = filter
+		return nil
+	}
+}
+
+// WithObserver makes the finder tell observer what happens to every meme. It
+// can be used many times to add many observers.
+func WithObserver(observer Observer) Option {
+	return func(f *Finder) error {
+		f.observers = append(f.observers, observer)
+		return nil
+	}
+}
+
+// WithNameTemplate makes the finder name saved memes with a text/template,
+// with the fields Index, ID1, ID2, Slug, Title, Date, Site and Ext
+func WithNameTemplate(template string) Option {
+	return func(f *Finder) error {
+		_, err := imgfinder.NewNamer(template)
+		if err != nil {
+			return err
+		}
+
+		f.nameTemplate = template
+		return nil
+	}
+}
+
+// WithOnConflict makes the finder handle memes that already exist with a
+// policy: overwrite, the default, skip, rename or fail
+func WithOnConflict(policy string) Option {
+	return func(f *Finder) error {
+		parsed, err := imgfinder.ParseConflictPolicy(policy)
+		if err != nil {
+			return err
+		}
+
+		f.onConflict = parsed
+		return nil
+	}
+}
+
+// WithManifest makes the finder record, or not, the saved memes in a
+// manifest.json in the output
+func WithManifest(enabled bool) Option {
+	return func(f *Finder) error {
+		f.manifest = enabled
+		return nil
+	}
+}
+
+// WithLog makes the finder report its progress to log
+func WithLog(log io.Writer) Option {
+	return func(f *Finder) error {
+		f.log = log
+		return nil
+	}
+}
+
+// Filter chooses which memes are saved. The zero value saves every meme.
+type Filter struct {
+	// Minimum dimensions in pixels and file size bounds in bytes. Zero
+	// means no bound.
+	MinWidth  int
+	MinHeight int
+	MinBytes  int
+	MaxBytes  int
+	// Aspect is the aspect ratio range, W:H, MIN-MAX, MIN- or -MAX, e.g.
+	// 4:3-16:9
+	Aspect string
+
+	// Include makes only memes whose title, alt text or slug match any of
+	// the keywords or /regexps/ be saved, and Exclude skips the ones that
+	// match any
+	Include []string
+	Exclude []string
+
+	// Sections are the only sections of the pages memes are saved from:
+	// feed, hot and lists. Empty means all of them.
+	Sections []string
+}
+
+func (filter Filter) internal() (imgfinder.Filter, error) {
+	parsed := imgfinder.Filter{
+		MinWidth:  filter.MinWidth,
+		MinHeight: filter.MinHeight,
+		MinBytes:  filter.MinBytes,
+		MaxBytes:  filter.MaxBytes,
+	}
+
+	var err error
+	if filter.Aspect != "" {
+		parsed.Aspect, err = imgfinder.ParseAspectRange(filter.Aspect)
+		if err != nil {
+			return parsed, err
+		}
+	}
+
+	if len(filter.Sections) > 0 {
+		parsed.Sections, err = imgfinder.ParseSections(strings.Join(filter.Sections, ","))
+		if err != nil {
+			return parsed, err
+		}
+	}
+
+	parsed.Include, err = parsePatterns(filter.Include)
+	if err != nil {
+		return parsed, err
+	}
+
+	parsed.Exclude, err = parsePatterns(filter.Exclude)
+	return parsed, err
+}
+
+func parsePatterns(sources []string) ([]imgfinder.TextPattern, error) {
+	var patterns []imgfinder.TextPattern
+	for _, source := range sources {
+		pattern, err := imgfinder.ParseTextPattern(source)
+		if err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+// Download downloads the memes of the sites. A meme that can't be downloaded
+// doesn't stop the others, it's in the failed ones of the result. The error
+// is for what stops the whole download, like a page that can't be scrapped,
+// and then the result has what was done until then.
+func (f *Finder) Download() (Result, error) {
+	var result Result
+
+	finder, dir, err := f.newFinder()
+	if err != nil {
+		return result, err
+	}
+
+	observers := append([]Observer{resultObserver{result: &result}}, f.observers...)
+	finder = finder.WithObserver(forwardingObserver{observers: observers})
+
+	err = finder.CollectAndDownloadFromSites(f.quotas, f.threads, dir)
+	return result, err
+}
+
+// newFinder returns the internal finder of the options, with the directory to
+// save memes to
+func (f *Finder) newFinder() (imgfinder.Finder, string, error) {
+	client := f.client
+	if client == nil {
+		profile := imgfinder.DefaultClientProfile
+
+		transport, err := profile.NewTransport()
+		if err != nil {
+			return imgfinder.Finder{}, "", err
+		}
+
+		client = profile.NewClient(transport)
+	}
+
+	scrapper := imgfinder.CheezburgerScrapper{ImageHosts: f.imageHosts, Transport: client.Transport, Timeout: client.Timeout, Log: f.log}
+
+	var fileSystem imgfinder.FileSystem = imgfinder.RealFileSystem{}
+	dir := f.output
+	switch {
+	case f.fileSystem != nil:
+		fileSystem = f.fileSystem
+	case strings.HasPrefix(f.output, "s3://"):
+		s3, err := imgfinder.NewS3FileSystem(f.output, client)
+		if err != nil {
+			return imgfinder.Finder{}, "", err
+		}
+
+		// Keys are relative to the bucket prefix
+		fileSystem, dir = s3, ""
+	}
+
+	filter, err := f.filter.internal()
+	if err != nil {
+		return imgfinder.Finder{}, "", err
+	}
+
+	namer, err := imgfinder.NewNamer(f.nameTemplate)
+	if err != nil {
+		return imgfinder.Finder{}, "", err
+	}
+
+	finder := imgfinder.New(scrapper, fileSystem, client).
+		WithFilter(filter).
+		WithNamer(namer).
+		WithConflictPolicy(f.onConflict).
+		WithManifest(f.manifest).
+		WithLog(f.log).
+		WithKeepGoing(true)
+
+	return finder, dir, nil
+}
@@ -0,0 +1,164 @@
+package catscraper_test
+
+import (
+	"cat-scraper/catscraper"
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/fakesite"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ catscraper.FileSystem = catscrapertest.NewFileSystem()
+
+func TestDownloadReturnsResult(t *testing.T) {
+	site := fakesite.New(fakesite.Config{})
+	broken := site.Memes()[0]
+
+	// Every meme but the first one can be downloaded
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/full/"+broken.ID1+"/"+broken.ID2) {
+			http.Error(w, "broken", http.StatusInternalServerError)
+			return
+		}
+
+		site.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	var events []catscraper.Event
+	dir := t.TempDir()
+	finder, err := catscraper.New(
+		catscraper.WithSite(server.URL, 5),
+		catscraper.WithImageHosts("127.0.0.1"),
+		catscraper.WithOutput(dir),
+		catscraper.WithConcurrency(2),
+		catscraper.WithOnConflict("skip"),
+		catscraper.WithObserver(catscraper.ObserverFunc(func(event catscraper.Event) {
+			events = append(events, event)
+		})),
+	)
+	require.NoError(t, err)
+
+	result, err := finder.Download()
+	require.NoError(t, err)
+
+	require.Len(t, result.Failed, 1)
+	assert.Contains(t, result.Failed[0].URL, broken.ID1)
+	assert.Error(t, result.Failed[0].Err)
+	assert.Empty(t, result.Skipped)
+	assert.Len(t, result.Saved, 4)
+	assert.Len(t, events, 5)
+
+	var size int64
+	for _, path := range result.Saved {
+		info, err := os.Stat(filepath.Join(dir, path))
+		require.NoError(t, err)
+		size += info.Size()
+	}
+	assert.Equal(t, size, result.Bytes)
+
+	// Downloading again skips the saved memes
+	result, err = finder.Download()
+	require.NoError(t, err)
+	assert.Len(t, result.Skipped, 4)
+	assert.Len(t, result.Failed, 1)
+	assert.Empty(t, result.Saved)
+}
+
+func TestDownloadSkipsFilteredMemes(t *testing.T) {
+	server, site := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	excluded := site.Memes()[0]
+	finder, err := catscraper.New(
+		catscraper.WithSite(server.URL, 3),
+		catscraper.WithImageHosts("127.0.0.1"),
+		catscraper.WithOutput(t.TempDir()),
+		catscraper.WithFilter(catscraper.Filter{Exclude: []string{strings.ReplaceAll(excluded.Slug, "-", " ")}}),
+		catscraper.WithManifest(false),
+	)
+	require.NoError(t, err)
+
+	result, err := finder.Download()
+	require.NoError(t, err)
+
+	// Rejected memes are replaced
+	assert.Len(t, result.Saved, 3)
+	require.NotEmpty(t, result.Skipped)
+	assert.Contains(t, result.Skipped[0].URL, excluded.ID1)
+	assert.Error(t, result.Skipped[0].Err)
+}
+
+// recordingTransport records the requests made through it
+type recordingTransport struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.requests = append(t.requests, req.Method+" "+req.URL.String())
+	t.mu.Unlock()
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestUploadsToS3WithTheClient(t *testing.T) {
+	server, _ := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	// Only uploads succeed, there's nothing to overwrite
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPut:
+		case r.URL.Query().Get("list-type") == "2":
+			w.Write([]byte("<ListBucketResult></ListBucketResult>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer storage.Close()
+	t.Setenv("AWS_ENDPOINT_URL", storage.URL)
+
+	transport := &recordingTransport{}
+	finder, err := catscraper.New(
+		catscraper.WithSite(server.URL, 1),
+		catscraper.WithImageHosts("127.0.0.1"),
+		catscraper.WithOutput("s3://memes/cats"),
+		catscraper.WithHTTPClient(&http.Client{Transport: transport}),
+		catscraper.WithManifest(false),
+	)
+	require.NoError(t, err)
+
+	result, err := finder.Download()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.jpg"}, result.Saved)
+	assert.Contains(t, transport.requests, "PUT "+storage.URL+"/memes/cats/1.jpg")
+}
+
+func TestRejectsInvalidOptions(t *testing.T) {
+	for name, option := range map[string]catscraper.Option{
+		"unknown site":    catscraper.WithSite("dogbase", 1),
+		"no amount":       catscraper.WithSite("memebase", 0),
+		"empty output":    catscraper.WithOutput(""),
+		"no concurrency":  catscraper.WithConcurrency(0),
+		"invalid aspect":  catscraper.WithFilter(catscraper.Filter{Aspect: "wide"}),
+		"invalid section": catscraper.WithFilter(catscraper.Filter{Sections: []string{"ads"}}),
+		"invalid pattern": catscraper.WithFilter(catscraper.Filter{Include: []string{"/(/"}}),
+		"invalid name":    catscraper.WithNameTemplate("{{.Index"),
+		"invalid policy":  catscraper.WithOnConflict("merge"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := catscraper.New(option)
+			assert.Error(t, err)
+		})
+	}
+}
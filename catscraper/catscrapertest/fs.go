@@ -0,0 +1,301 @@
+// Package catscrapertest provides fakes of the dependencies of the scraper, so
+// code that embeds it can be tested without touching the network or the disk.
+// They can be passed to catscraper with WithFileSystem and WithHTTPClient.
+package catscrapertest
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// An Op is a FileSystem operation in which errors can be injected
+type Op string
+
+const (
+	OpWriteFile Op = "write"
+	OpMkdirAll  Op = "mkdir"
+	OpReadFile  Op = "read"
+	OpStat      Op = "stat"
+	OpRemove    Op = "remove"
+	OpReadDir   Op = "readdir"
+)
+
+// FileSystem is an in-memory catscraper.FileSystem. It is safe for concurrent
+// use.
+//
+// It behaves like a real file system regarding directories: files can only be
+// written inside existing directories, and a path can't be both a file and a
+// directory. The current directory always exists.
+type FileSystem struct {
+	mu       sync.Mutex
+	files    map[string][]byte
+	dirs     map[string]bool
+	failures []failure
+}
+
+type failure struct {
+	op      Op
+	pattern string
+	err     error
+}
+
+func NewFileSystem() *FileSystem {
+	return &FileSystem{
+		files: map[string][]byte{},
+		dirs:  map[string]bool{},
+	}
+}
+
+// FailOn makes every operation op on a path that matches pattern (with the
+// syntax of path.Match) fail with err. An empty pattern matches every path.
+func (m *FileSystem) FailOn(op Op, pattern string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.failures = append(m.failures, failure{op: op, pattern: pattern, err: err})
+}
+
+func (m *FileSystem) WriteFile(name string, data []byte, _ os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if err := m.injectedError(OpWriteFile, name); err != nil {
+		return err
+	}
+
+	if m.dirs[name] {
+		return &fs.PathError{Op: "open", Path: name, Err: errors.New("is a directory")}
+	}
+
+	if !m.isDir(filepath.Dir(name)) {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *FileSystem) MkdirAll(name string, _ os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if err := m.injectedError(OpMkdirAll, name); err != nil {
+		return err
+	}
+
+	var toCreate []string
+	for dir := name; !m.isDir(dir); dir = filepath.Dir(dir) {
+		if _, isFile := m.files[dir]; isFile {
+			return &fs.PathError{Op: "mkdir", Path: dir, Err: errors.New("not a directory")}
+		}
+
+		toCreate = append(toCreate, dir)
+	}
+
+	for _, dir := range toCreate {
+		m.dirs[dir] = true
+	}
+
+	return nil
+}
+
+// ReadFile returns the content of a file written to the file system
+func (m *FileSystem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if err := m.injectedError(OpReadFile, name); err != nil {
+		return nil, err
+	}
+
+	data, ok := m.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	return append([]byte(nil), data...), nil
+}
+
+func (m *FileSystem) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if err := m.injectedError(OpStat, name); err != nil {
+		return nil, err
+	}
+
+	return m.stat(name)
+}
+
+func (m *FileSystem) Exists(name string) (bool, error) {
+	_, err := m.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Remove removes a file or an empty directory
+func (m *FileSystem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if err := m.injectedError(OpRemove, name); err != nil {
+		return err
+	}
+
+	if _, isFile := m.files[name]; isFile {
+		delete(m.files, name)
+		return nil
+	}
+
+	if !m.dirs[name] {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+
+	if len(m.children(name)) > 0 {
+		return &fs.PathError{Op: "remove", Path: name, Err: errors.New("directory not empty")}
+	}
+
+	delete(m.dirs, name)
+	return nil
+}
+
+// ReadDir returns the entries of a directory sorted by name
+func (m *FileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = clean(name)
+	if err := m.injectedError(OpReadDir, name); err != nil {
+		return nil, err
+	}
+
+	if !m.isDir(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	var entries []os.DirEntry
+	for _, child := range m.children(name) {
+		info, _ := m.stat(child)
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+
+	return entries, nil
+}
+
+// Files returns the content of every file in the file system by its path
+func (m *FileSystem) Files() map[string][]byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files := map[string][]byte{}
+	for name, data := range m.files {
+		files[name] = append([]byte(nil), data...)
+	}
+
+	return files
+}
+
+// Dirs returns every directory created in the file system, sorted
+func (m *FileSystem) Dirs() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var dirs []string
+	for dir := range m.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	return dirs
+}
+
+func (m *FileSystem) stat(name string) (os.FileInfo, error) {
+	if data, isFile := m.files[name]; isFile {
+		return fileInfo{name: filepath.Base(name), size: int64(len(data))}, nil
+	}
+
+	if m.isDir(name) {
+		return fileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// children returns the paths of the files and directories inside dir, sorted
+func (m *FileSystem) children(dir string) []string {
+	var children []string
+	for name := range m.files {
+		if filepath.Dir(name) == dir {
+			children = append(children, name)
+		}
+	}
+
+	for name := range m.dirs {
+		if filepath.Dir(name) == dir && name != dir {
+			children = append(children, name)
+		}
+	}
+	sort.Strings(children)
+
+	return children
+}
+
+func (m *FileSystem) isDir(name string) bool {
+	return name == "." || name == string(filepath.Separator) || m.dirs[name]
+}
+
+func (m *FileSystem) injectedError(op Op, name string) error {
+	for _, f := range m.failures {
+		if f.op != op {
+			continue
+		}
+
+		if f.pattern == "" {
+			return f.err
+		}
+
+		if matched, _ := path.Match(f.pattern, filepath.ToSlash(name)); matched {
+			return f.err
+		}
+	}
+
+	return nil
+}
+
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() any           { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0777
+	}
+
+	return 0666
+}
+
+func clean(name string) string {
+	return filepath.Clean(name)
+}
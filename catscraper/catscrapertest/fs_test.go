@@ -0,0 +1,76 @@
+package catscrapertest_test
+
+import (
+	"cat-scraper/catscraper"
+	"cat-scraper/catscraper/catscrapertest"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ catscraper.FileSystem = catscrapertest.NewFileSystem()
+
+func TestFileSystemWritesAndReadsBack(t *testing.T) {
+	fileSystem := catscrapertest.NewFileSystem()
+
+	require.NoError(t, fileSystem.MkdirAll("images/cats/", 0777))
+	require.NoError(t, fileSystem.WriteFile("images/cats/1.jpg", []byte("meow"), 0777))
+
+	content, err := fileSystem.ReadFile("images/cats/1.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("meow"), content)
+
+	assert.Equal(t, []string{"images", "images/cats"}, fileSystem.Dirs())
+	assert.Equal(t, map[string][]byte{"images/cats/1.jpg": []byte("meow")}, fileSystem.Files())
+}
+
+func TestFileSystemDirectorySemantics(t *testing.T) {
+	fileSystem := catscrapertest.NewFileSystem()
+
+	// The parent directory must exist
+	err := fileSystem.WriteFile("images/1.jpg", []byte("meow"), 0777)
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	// Files in the current directory are always allowed
+	require.NoError(t, fileSystem.WriteFile("1.jpg", []byte("meow"), 0777))
+
+	// Files and directories can't share a path
+	require.EqualError(t, fileSystem.MkdirAll("1.jpg/thumbs", 0777), "mkdir 1.jpg: not a directory")
+	require.NoError(t, fileSystem.MkdirAll("images", 0777))
+	require.EqualError(t, fileSystem.WriteFile("images", nil, 0777), "open images: is a directory")
+
+	_, err = fileSystem.ReadFile("missing.jpg")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+}
+
+func TestFileSystemInjectedErrors(t *testing.T) {
+	fileSystem := catscrapertest.NewFileSystem()
+	fileSystem.FailOn(catscrapertest.OpWriteFile, "*.gif", errors.New("disk full"))
+	fileSystem.FailOn(catscrapertest.OpMkdirAll, "", errors.New("read only"))
+
+	require.NoError(t, fileSystem.WriteFile("1.jpg", nil, 0777))
+	require.EqualError(t, fileSystem.WriteFile("2.gif", nil, 0777), "disk full")
+	require.EqualError(t, fileSystem.MkdirAll("images", 0777), "read only")
+}
+
+func TestFileSystemIsSafeForConcurrentUse(t *testing.T) {
+	fileSystem := catscrapertest.NewFileSystem()
+	require.NoError(t, fileSystem.MkdirAll("images", 0777))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, fileSystem.WriteFile(fmt.Sprintf("images/%d.jpg", i), []byte("meow"), 0777))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, fileSystem.Files(), 50)
+}
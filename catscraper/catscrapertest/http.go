@@ -0,0 +1,185 @@
+package catscrapertest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// A Response is a canned response served by a Getter or a Site
+type Response struct {
+	Content     []byte
+	ContentType string
+	StatusCode  int
+	Header      http.Header
+}
+
+// Getter is a programmable HTTP getter. It is safe for concurrent use. It's
+// also an http.RoundTripper, so it can be the transport of an http.Client.
+//
+// Requests to URLs without a response fail with an error, unless a fallback is
+// set with HandleFunc("", ...).
+type Getter struct {
+	mu       sync.Mutex
+	handlers map[string]func(url string) (*http.Response, error)
+	requests []string
+
+	// Err makes every request fail
+	Err error
+}
+
+func NewGetter() *Getter {
+	return &Getter{handlers: map[string]func(url string) (*http.Response, error){}}
+}
+
+// Handle makes the getter answer requests to url with resp. An empty url sets
+// the response for every url without one.
+func (g *Getter) Handle(url string, resp Response) {
+	g.HandleFunc(url, func(string) (*http.Response, error) {
+		return resp.httpResponse(), nil
+	})
+}
+
+// HandleFunc makes the getter answer requests to url with whatever handler
+// returns. An empty url sets the handler for every url without one.
+func (g *Getter) HandleFunc(url string, handler func(url string) (*http.Response, error)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.handlers[url] = handler
+}
+
+func (g *Getter) Get(url string) (*http.Response, error) {
+	g.mu.Lock()
+	g.requests = append(g.requests, url)
+	handler, ok := g.handlers[url]
+	if !ok {
+		handler, ok = g.handlers[""]
+	}
+	err := g.Err
+	g.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("url '%s' not found", url)
+	}
+
+	return handler(url)
+}
+
+// RoundTrip answers a request like Get, whatever its method
+func (g *Getter) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := g.Get(req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Request = req
+	return resp, nil
+}
+
+// Requests returns every url requested so far, in order
+func (g *Getter) Requests() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]string(nil), g.requests...)
+}
+
+func (r Response) httpResponse() *http.Response {
+	rec := httptest.NewRecorder()
+	for name, values := range r.Header {
+		rec.Header()[name] = values
+	}
+
+	if r.ContentType != "" {
+		rec.Header().Set("Content-Type", r.ContentType)
+	}
+
+	statusCode := r.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	rec.WriteHeader(statusCode)
+	rec.Write(r.Content)
+
+	return rec.Result()
+}
+
+// Site is a fake website served over HTTP, to be used with the real scrapper.
+// Pages are built from the HTML of the img elements they contain. Requests to
+// paths without a page or a response get a 404 Not Found.
+type Site struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses map[string]Response
+}
+
+// NewSite starts a fake site. It should be closed when no longer used.
+func NewSite() *Site {
+	s := &Site{responses: map[string]Response{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+// Page makes the site serve an HTML page at path with the given img elements
+func (s *Site) Page(path string, images ...string) {
+	s.Handle(path, Response{
+		ContentType: "text/html",
+		Content:     []byte(PageHTML(images...)),
+	})
+}
+
+// Handle makes the site answer requests to path with resp
+func (s *Site) Handle(path string, resp Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses[path] = resp
+}
+
+func (s *Site) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	resp, ok := s.responses[r.URL.Path]
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	for name, values := range resp.Header {
+		w.Header()[name] = values
+	}
+
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+
+	if resp.StatusCode != 0 {
+		w.WriteHeader(resp.StatusCode)
+	}
+
+	w.Write(resp.Content)
+}
+
+// PageHTML builds an HTML page with the given img elements in its body
+func PageHTML(images ...string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<title>Test Page</title>
+</head>
+<body>
+%s
+</body>
+</html>`, strings.Join(images, " "))
+}
@@ -0,0 +1,83 @@
+package catscrapertest_test
+
+import (
+	"cat-scraper/catscraper"
+	"cat-scraper/catscraper/catscrapertest"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ http.RoundTripper = catscrapertest.NewGetter()
+
+func TestGetterServesResponsesAndRecordsRequests(t *testing.T) {
+	getter := catscrapertest.NewGetter()
+	getter.Handle("https://i.chzbgr.com/full/1/h1", catscrapertest.Response{Content: []byte("meow"), ContentType: "image/png"})
+	getter.HandleFunc("", func(url string) (*http.Response, error) {
+		return nil, errors.New("offline")
+	})
+
+	resp, err := getter.Get("https://i.chzbgr.com/full/1/h1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("meow"), body)
+
+	_, err = getter.Get("https://i.chzbgr.com/full/2/h2")
+	require.EqualError(t, err, "offline")
+
+	assert.Equal(t, []string{"https://i.chzbgr.com/full/1/h1", "https://i.chzbgr.com/full/2/h2"}, getter.Requests())
+}
+
+func TestGetterUnknownURL(t *testing.T) {
+	_, err := catscrapertest.NewGetter().Get("https://i.chzbgr.com/full/1/h1")
+	require.EqualError(t, err, "url 'https://i.chzbgr.com/full/1/h1' not found")
+}
+
+func TestSiteWithRealScrapper(t *testing.T) {
+	site := catscrapertest.NewSite()
+	defer site.Close()
+
+	site.Page("/", `<img class="resp-media" src="`+site.URL+`/thumb800/1/h1/slug">`)
+	site.Handle("/full/1/h1", catscrapertest.Response{ContentType: "image/jpeg", Content: []byte("meow")})
+	fileSystem := catscrapertest.NewFileSystem()
+
+	finder, err := catscraper.New(
+		catscraper.WithSite(site.URL, 1),
+		catscraper.WithImageHosts("127.0.0.1"),
+		catscraper.WithFileSystem(fileSystem),
+		catscraper.WithOutput("memes"),
+		catscraper.WithManifest(false),
+	)
+	require.NoError(t, err)
+
+	result, err := finder.Download()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.jpg"}, result.Saved)
+	assert.Equal(t, []byte("meow"), fileSystem.Files()["memes/1.jpg"])
+
+	resp, err := http.Get(site.URL + "/page/3")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestGetterAsTransport(t *testing.T) {
+	getter := catscrapertest.NewGetter()
+	getter.Handle("https://icanhas.cheezburger.com/", catscrapertest.Response{Content: []byte("<html></html>"), ContentType: "text/html"})
+	client := &http.Client{Transport: getter}
+
+	resp, err := client.Get("https://icanhas.cheezburger.com/")
+	require.NoError(t, err)
+	assert.Equal(t, "text/html", resp.Header.Get("Content-Type"))
+
+	_, err = client.Get("https://icanhas.cheezburger.com/page/2")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"https://icanhas.cheezburger.com/", "https://icanhas.cheezburger.com/page/2"}, getter.Requests())
+}
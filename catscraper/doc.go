@@ -0,0 +1,33 @@
+// Package catscraper downloads memes from the sites of the Cheezburger network,
+// for programs that embed the scraper instead of running its command line.
+//
+// A Finder is built with New and functional options, and every call to
+// Download scraps the sites, downloads the memes and returns a Result with
+// what was saved, skipped and failed:
+//
+//	finder, err := catscraper.New(
+//		catscraper.WithSite("memebase", 20),
+//		catscraper.WithOutput("memes/"),
+//		catscraper.WithConcurrency(4),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//
+//	result, err := finder.Download()
+//
+// # Compatibility
+//
+// This package and catscrapertest follow semantic versioning, unlike the
+// internal packages of the module, which they wrap. Within a major version:
+//
+//   - Exported identifiers are not removed or renamed, and the signatures of
+//     functions and methods don't change.
+//   - New options, fields and event kinds may be added. Build structs with
+//     field names, and handle unknown event kinds, so that keeps compiling and
+//     working.
+//   - The defaults documented on New and the options don't change.
+//
+// Only what these packages export is covered. Log output, error messages and
+// the layout of the manifest may change.
+package catscraper
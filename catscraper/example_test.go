@@ -0,0 +1,132 @@
+package catscraper_test
+
+import (
+	"cat-scraper/catscraper"
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/fakesite"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+func ExampleNew() {
+	// A fake site, as memes are downloaded from the real ones
+	server, _ := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	dir, err := os.MkdirTemp("", "memes")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	finder, err := catscraper.New(
+		catscraper.WithSite(server.URL, 3),
+		catscraper.WithImageHosts("127.0.0.1"),
+		catscraper.WithOutput(dir),
+		catscraper.WithConcurrency(2),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result, err := finder.Download()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(result.Saved)
+	// Output: [1.jpg 2.png 3.gif]
+}
+
+func ExampleWithObserver() {
+	server, _ := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	dir, err := os.MkdirTemp("", "memes")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	finder, err := catscraper.New(
+		catscraper.WithSite(server.URL, 2),
+		catscraper.WithImageHosts("127.0.0.1"),
+		catscraper.WithOutput(dir),
+		catscraper.WithObserver(catscraper.ObserverFunc(func(event catscraper.Event) {
+			fmt.Println(event.Kind, event.Path)
+		})),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = finder.Download()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Output:
+	// saved 1.jpg
+	// saved 2.png
+}
+
+func ExampleFilter() {
+	server, _ := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	dir, err := os.MkdirTemp("", "memes")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	finder, err := catscraper.New(
+		catscraper.WithSite(server.URL, 2),
+		catscraper.WithImageHosts("127.0.0.1"),
+		catscraper.WithOutput(dir),
+		catscraper.WithFilter(catscraper.Filter{Sections: []string{"hot"}}),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result, err := finder.Download()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("saved %d memes of the hot section, skipped %d\n", len(result.Saved), len(result.Skipped))
+	// Output: saved 2 memes of the hot section, skipped 8
+}
+
+func ExampleWithFileSystem() {
+	// Fakes of the site and the disk, to test code that downloads memes
+	getter := catscrapertest.NewGetter()
+	getter.Handle("https://icanhas.cheezburger.com/", catscrapertest.Response{
+		ContentType: "text/html",
+		Content:     []byte(catscrapertest.PageHTML(`<img class="resp-media" src="https://i.chzbgr.com/full/1/hA/grumpy-cat">`)),
+	})
+	getter.Handle("https://i.chzbgr.com/full/1/hA", catscrapertest.Response{ContentType: "image/jpeg", Content: []byte("meme")})
+	fileSystem := catscrapertest.NewFileSystem()
+
+	finder, err := catscraper.New(
+		catscraper.WithSite("icanhas", 1),
+		catscraper.WithHTTPClient(&http.Client{Transport: getter}),
+		catscraper.WithFileSystem(fileSystem),
+		catscraper.WithOutput("memes"),
+		catscraper.WithManifest(false),
+	)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	result, err := finder.Download()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(result.Saved, string(fileSystem.Files()["memes/1.jpg"]))
+	// Output: [1.jpg] meme
+}
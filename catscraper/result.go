@@ -0,0 +1,96 @@
+package catscraper
+
+import "cat-scraper/internal/imgfinder"
+
+// Result is what a download did
+type Result struct {
+	// Saved are the paths of the saved memes, relative to the output, with /
+	// separators
+	Saved []string
+	// Skipped are the memes that weren't saved because the filter rejected
+	// them or they already exist, and Failed the ones that couldn't be
+	// downloaded or saved
+	Skipped []Event
+	Failed  []Event
+	// Bytes is the size of the saved memes
+	Bytes int64
+}
+
+// EventKind is what happened to a meme
+type EventKind string
+
+const (
+	EventSaved   EventKind = "saved"
+	EventSkipped EventKind = "skipped"
+	EventFailed  EventKind = "failed"
+)
+
+// An Event is what happened to a meme of a download
+type Event struct {
+	Kind EventKind
+	// URL is where the meme is downloaded from, in full size
+	URL   string
+	Title string
+	// Site is the name of the site the meme was found on
+	Site string
+
+	// Path of the saved meme relative to the output, with / separators, and
+	// its size in bytes
+	Path  string
+	Bytes int
+
+	// Err is why the meme was skipped or failed
+	Err error
+}
+
+// An Observer is told what happens to every meme of a download, as it
+// happens. Events are observed one at a time, so observers don't need to be
+// safe for concurrent use.
+type Observer interface {
+	Observe(event Event)
+}
+
+// ObserverFunc is a function that observes events
+type ObserverFunc func(event Event)
+
+func (f ObserverFunc) Observe(event Event) {
+	f(event)
+}
+
+// resultObserver builds the result of a download from its events
+type resultObserver struct {
+	result *Result
+}
+
+func (o resultObserver) Observe(event Event) {
+	switch event.Kind {
+	case EventSaved:
+		o.result.Saved = append(o.result.Saved, event.Path)
+		o.result.Bytes += int64(event.Bytes)
+	case EventSkipped:
+		o.result.Skipped = append(o.result.Skipped, event)
+	case EventFailed:
+		o.result.Failed = append(o.result.Failed, event)
+	}
+}
+
+// forwardingObserver tells observers the events of the internal finder
+type forwardingObserver struct {
+	observers []Observer
+}
+
+func (o forwardingObserver) Observe(internal imgfinder.Event) {
+	event := Event{
+		Kind:  EventKind(internal.Kind),
+		URL:   internal.Image.URL,
+		Title: internal.Image.Title,
+		Site:  internal.Image.Site,
+		Path:  internal.Path,
+		Bytes: internal.Size,
+		Err:   internal.Err,
+	}
+
+	for _, observer := range o.observers {
+		observer.Observe(event)
+	}
+}
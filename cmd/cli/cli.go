@@ -2,26 +2,390 @@ package cli
 
 import (
 	"cat-scraper/internal/imgfinder"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 )
 
-// Command line flags
-var (
-	amount  = flag.Int("amount", 10, "how many memes to download")
-	threads = flag.Int("threads", 1, "number of threads that will download images concurrently (max: 5)")
-)
+// Run runs the command of the command line arguments (without the program
+// name) with finder. Without a command it downloads memes. The output of the
+// command goes to stdout, and the usage and the progress of commands whose
+// output can be piped go to stderr.
+func Run(finder imgfinder.Finder, args []string, lookupEnv func(string) (string, bool), stdout io.Writer, stderr io.Writer) error {
+	command := defaultCommand
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	if command == "help" {
+		printUsage(stderr)
+		return nil
+	}
+
+	config, err := loadConfig(command, args, lookupEnv, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if config.PrintConfig {
+		fmt.Fprint(stdout, config)
+		return nil
+	}
+
+	cmd, _ := findCommand(command)
+	return cmd.run(finder.WithLog(stdout), config, stdout, stderr)
+}
+
+func download(finder imgfinder.Finder, config Config, stdout io.Writer, stderr io.Writer) error {
+	// A dry run only prints the memes to stdout, so they can be piped into
+	// other tools
+	log := stdout
+	if config.DryRun {
+		log = stderr
+	}
+
+	finder, err := withSource(finder, config, log)
+	if err != nil {
+		return err
+	}
+
+	namer, err := imgfinder.NewNamer(config.NameTemplate)
+	if err != nil {
+		return err
+	}
+	finder = finder.WithNamer(namer)
+
+	imageSize, err := imgfinder.ParseSize(config.Size)
+	if err != nil {
+		return err
+	}
+	finder = finder.WithSize(imageSize)
+
+	thumbnailWidths, err := imgfinder.ParseThumbnailWidths(config.Thumbs)
+	if err != nil {
+		return err
+	}
+
+	gifMode, err := imgfinder.ParseGIFThumbnailMode(config.ThumbsGIF)
+	if err != nil {
+		return err
+	}
+	finder = finder.WithThumbnails(imgfinder.Thumbnails{Widths: thumbnailWidths, GIF: gifMode})
+
+	if config.ConvertTo != "" {
+		conversion, err := parseConversion(config)
+		if err != nil {
+			return err
+		}
+		finder = finder.WithConversion(conversion)
+	}
+	finder = finder.WithManifest(config.Manifest).WithProvenance(config.EmbedProvenance).WithStripMetadata(config.StripMetadata)
+
+	conflictPolicy, err := imgfinder.ParseConflictPolicy(config.OnConflict)
+	if err != nil {
+		return err
+	}
+	finder = finder.WithConflictPolicy(conflictPolicy).WithContinueNumbering(config.Continue)
+
+	if config.URLsFrom != "" {
+		return downloadList(finder, config, stdout, log)
+	}
+
+	quotas, err := parseSiteQuotas(config)
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, quota := range quotas {
+		total += quota.Amount
+	}
+	fmt.Fprintf(log, "Downloading %d memes with %d threads\n", total, config.Threads)
+
+	if config.DryRun {
+		planned, err := finder.PlanImages(quotas)
+		if err != nil {
+			return err
+		}
+
+		return printPlan(planned, stdout)
+	}
+
+	finder, imagesDirectory, err := withLibrary(finder, config)
+	if err != nil {
+		return err
+	}
+
+	err = finder.CollectAndDownloadFromSites(quotas, config.Threads, imagesDirectory)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, "Images saved successfully")
+	return nil
+}
+
+// downloadList downloads the memes of the list of the settings instead of
+// scrapping them, reporting its progress to log
+func downloadList(finder imgfinder.Finder, config Config, stdout io.Writer, log io.Writer) error {
+	images, err := readImageList(finder, config.URLsFrom)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(log, "Downloading %d memes with %d threads\n", len(images), config.Threads)
+
+	if config.DryRun {
+		planned, err := finder.PlanDownload(images)
+		if err != nil {
+			return err
+		}
+
+		return printPlan(planned, stdout)
+	}
 
-func Run(finder imgfinder.Finder) error {
-	flag.Parse()
-	fmt.Printf("Downloading %d memes with %d threads\n", *amount, *threads)
+	finder, imagesDirectory, err := withLibrary(finder, config)
+	if err != nil {
+		return err
+	}
 
-	const imagesDirectory = "images/"
-	err := finder.CollectAndDownloadImages(*amount, *threads, imagesDirectory)
+	err = finder.DownloadImages(images, config.Threads, imagesDirectory)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Images saved successfully")
+	fmt.Fprintln(stdout, "Images saved successfully")
 	return nil
 }
+
+// readImageList reads the image list of a file, or stdin if it's -
+func readImageList(finder imgfinder.Finder, name string) ([]imgfinder.Image, error) {
+	if name == "-" {
+		return finder.ReadImageList(os.Stdin)
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("opening image list: %s", err)
+	}
+	defer file.Close()
+
+	return finder.ReadImageList(file)
+}
+
+// withProfile makes the finder request pages and memes with the client of the
+// settings, reporting the pages it visits to log
+func withProfile(finder imgfinder.Finder, config Config, log io.Writer) (imgfinder.Finder, error) {
+	profile := config.clientProfile()
+	transport, err := newTransport(config, profile)
+	if err != nil {
+		return finder, err
+	}
+
+	return withClient(finder, splitList(config.ImageHosts), profile, transport, log), nil
+}
+
+// withSource makes the finder find memes in the sites of the settings with
+// their filter, reporting its progress to log
+func withSource(finder imgfinder.Finder, config Config, log io.Writer) (imgfinder.Finder, error) {
+	finder, err := withProfile(finder, config, log)
+	if err != nil {
+		return finder, err
+	}
+
+	filter := imgfinder.Filter{
+		MinWidth:  config.MinWidth,
+		MinHeight: config.MinHeight,
+		MinBytes:  config.MinBytes,
+		MaxBytes:  config.MaxBytes,
+	}
+	filter.Include, err = parsePatterns(config.Include)
+	if err != nil {
+		return finder, err
+	}
+
+	filter.Exclude, err = parsePatterns(config.Exclude)
+	if err != nil {
+		return finder, err
+	}
+
+	filter.Sections, err = imgfinder.ParseSections(config.Sections)
+	if err != nil {
+		return finder, err
+	}
+
+	if config.Aspect != "" {
+		filter.Aspect, err = imgfinder.ParseAspectRange(config.Aspect)
+		if err != nil {
+			return finder, err
+		}
+	}
+
+	return finder.WithFilter(filter).WithVerbose(config.Verbose).WithLog(log), nil
+}
+
+// withLibrary makes the finder save memes to the output of the settings, and
+// returns the images directory in its file system
+func withLibrary(finder imgfinder.Finder, config Config) (imgfinder.Finder, string, error) {
+	if !strings.HasPrefix(config.Out, "s3://") {
+		return finder, config.Out, nil
+	}
+
+	// Uploads have the timeouts of the client profile, but skip the cache and
+	// the cassettes, which are for the pages and memes
+	profile := config.clientProfile()
+	transport, err := profile.NewTransport()
+	if err != nil {
+		return finder, "", fmt.Errorf("invalid client profile: %s", err)
+	}
+
+	fileSystem, err := imgfinder.NewS3FileSystem(config.Out, profile.NewClient(transport))
+	if err != nil {
+		return finder, "", err
+	}
+
+	// Keys are relative to the bucket prefix
+	return finder.WithFileSystem(fileSystem), "", nil
+}
+
+// withClient makes the finder scrap images from imageHosts, and makes both
+// the scrapper and the downloads make their requests with transport and the
+// total timeout of profile. The scrapper reports the pages it visits to log.
+func withClient(finder imgfinder.Finder, imageHosts []string, profile imgfinder.ClientProfile, transport http.RoundTripper, log io.Writer) imgfinder.Finder {
+	scrapper := imgfinder.CheezburgerScrapper{
+		ImageHosts: imageHosts,
+		Transport:  transport,
+		Timeout:    profile.Timeout,
+		Log:        log,
+	}
+
+	return finder.WithScrapper(scrapper).WithGetter(profile.NewClient(transport))
+}
+
+// newTransport returns the transport of the client profile, with the cache
+// and cassette of the settings
+func newTransport(config Config, profile imgfinder.ClientProfile) (http.RoundTripper, error) {
+	// Replays never go online
+	if config.Replay != "" {
+		return imgfinder.ReplayTransport{Dir: config.Replay}, nil
+	}
+
+	transport, err := profile.NewTransport()
+	if err != nil {
+		return nil, fmt.Errorf("invalid client profile: %s", err)
+	}
+
+	if !config.NoCache {
+		cache, err := newCache(config)
+		if err != nil {
+			return nil, err
+		}
+
+		cache.Next = transport
+		transport = cache
+	}
+
+	// Recordings save what the cache answers
+	if config.Record != "" {
+		transport = imgfinder.RecordingTransport{Dir: config.Record, Next: transport}
+	}
+
+	return transport, nil
+}
+
+// splitList splits a comma separated list, leaving out empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// newCache returns the cache of the settings
+func newCache(config Config) (imgfinder.CachingTransport, error) {
+	dir := config.CacheDir
+	if dir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return imgfinder.CachingTransport{}, fmt.Errorf("finding the cache directory, set one with --cache-dir: %s", err)
+		}
+
+		dir = filepath.Join(userCacheDir, "cat-scraper")
+	}
+
+	return imgfinder.CachingTransport{
+		Dir:      dir,
+		MaxBytes: int64(config.CacheSize) << 20,
+		TTL:      config.CacheTTL,
+	}, nil
+}
+
+// parseSiteQuotas returns the quotas of --from, or --amount memes from --site
+func parseSiteQuotas(config Config) ([]imgfinder.SiteQuota, error) {
+	if config.From != "" {
+		return imgfinder.ParseSiteQuotas(config.From)
+	}
+
+	parsed, err := imgfinder.ParseSite(config.Site)
+	if err != nil {
+		return nil, err
+	}
+
+	return []imgfinder.SiteQuota{{Site: parsed, Amount: config.Amount}}, nil
+}
+
+func parsePatterns(sources []string) ([]imgfinder.TextPattern, error) {
+	var patterns []imgfinder.TextPattern
+	for _, source := range sources {
+		pattern, err := imgfinder.ParseTextPattern(source)
+		if err != nil {
+			return nil, err
+		}
+
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+func parseConversion(config Config) (imgfinder.Conversion, error) {
+	// Without a format memes aren't converted
+	var contentType string
+	if config.ConvertTo != "" {
+		var err error
+		contentType, err = imgfinder.ParseConversionFormat(config.ConvertTo)
+		if err != nil {
+			return imgfinder.Conversion{}, err
+		}
+	}
+
+	backgroundColor, err := imgfinder.ParseColor(config.Background)
+	if err != nil {
+		return imgfinder.Conversion{}, err
+	}
+
+	gifMode, err := imgfinder.ParseGIFConversionMode(config.ConvertGIF)
+	if err != nil {
+		return imgfinder.Conversion{}, err
+	}
+
+	return imgfinder.Conversion{
+		ContentType: contentType,
+		Quality:     config.Quality,
+		Background:  backgroundColor,
+		GIF:         gifMode,
+	}, nil
+}
@@ -0,0 +1,210 @@
+package cli_test
+
+import (
+	"bytes"
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/cmd/cli"
+	"cat-scraper/internal/fakesite"
+	"cat-scraper/internal/imgfinder"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunDownloadsFromSite(t *testing.T) {
+	server, site := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	writer := catscrapertest.NewFileSystem()
+	finder := imgfinder.New(imgfinder.CheezburgerScrapper{}, writer, http.DefaultClient)
+
+	err := cli.Run(finder, []string{
+		"--site", server.URL,
+		"--image-hosts", "127.0.0.1",
+		"--amount", "2",
+		"--no-cache",
+		"--manifest=false",
+		"--name-template", "{{.ID1}}{{.Ext}}",
+	}, env(map[string]string{"CATSCRAPER_OUT": "memes"}), io.Discard, io.Discard)
+	require.NoError(t, err)
+
+	memes := site.Memes()
+	assert.Len(t, writer.Files(), 2)
+	assert.Contains(t, writer.Files(), "memes/"+memes[0].ID1+".jpg")
+	assert.Contains(t, writer.Files(), "memes/"+memes[1].ID1+".png")
+}
+
+func TestRunDryRunDownloadsNothing(t *testing.T) {
+	site := fakesite.New(fakesite.Config{})
+
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		site.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	writer := catscrapertest.NewFileSystem()
+	finder := imgfinder.New(imgfinder.CheezburgerScrapper{}, writer, http.DefaultClient)
+
+	var stdout, stderr bytes.Buffer
+	err := cli.Run(finder, []string{
+		"download",
+		"--site", server.URL,
+		"--image-hosts", "127.0.0.1",
+		"--amount", "2",
+		"--no-cache",
+		"--dry-run",
+	}, env(nil), &stdout, &stderr)
+	require.NoError(t, err)
+
+	// Only the feed is scrapped
+	assert.Equal(t, []string{"/"}, requested)
+	assert.Empty(t, writer.Files())
+
+	// Only the memes go to stdout
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"filename":"1"`)
+	assert.Contains(t, stderr.String(), "Downloading 2 memes")
+}
+
+func TestRunDownloadsListedMemes(t *testing.T) {
+	server, site := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	writer := catscrapertest.NewFileSystem()
+	finder := imgfinder.New(imgfinder.CheezburgerScrapper{}, writer, http.DefaultClient)
+
+	var listed bytes.Buffer
+	err := cli.Run(finder, []string{
+		"list",
+		"--site", server.URL,
+		"--image-hosts", "127.0.0.1",
+		"--amount", "2",
+		"--no-cache",
+	}, env(nil), &listed, io.Discard)
+	require.NoError(t, err)
+
+	list := filepath.Join(t.TempDir(), "memes.ndjson")
+	require.NoError(t, os.WriteFile(list, listed.Bytes(), 0666))
+
+	var stdout bytes.Buffer
+	err = cli.Run(finder, []string{
+		"--urls-from", list,
+		"--image-hosts", "127.0.0.1",
+		"--no-cache",
+		"--manifest=false",
+		"--out", "memes",
+		"--name-template", "{{.ID1}}{{.Ext}}",
+	}, env(nil), &stdout, io.Discard)
+	require.NoError(t, err)
+
+	memes := site.Memes()
+	assert.Len(t, writer.Files(), 2)
+	assert.Contains(t, writer.Files(), "memes/"+memes[0].ID1+".jpg")
+	assert.Contains(t, writer.Files(), "memes/"+memes[1].ID1+".png")
+	assert.Contains(t, stdout.String(), "Images saved successfully")
+}
+
+func TestRunDownloadsURLList(t *testing.T) {
+	server, site := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	memes := site.Memes()
+	list := filepath.Join(t.TempDir(), "memes.txt")
+	require.NoError(t, os.WriteFile(list, []byte(strings.Join([]string{
+		fmt.Sprintf("%s/thumb800/%s/%s/%s", server.URL, memes[1].ID1, memes[1].ID2, memes[1].Slug),
+		fmt.Sprintf(`{"url":"%s/full/%s/%s","title":"First"}`, server.URL, memes[0].ID1, memes[0].ID2),
+		fmt.Sprintf("%s/full/%s/%s", server.URL, memes[1].ID1, memes[1].ID2),
+	}, "\n")), 0666))
+
+	writer := catscrapertest.NewFileSystem()
+	finder := imgfinder.New(imgfinder.CheezburgerScrapper{}, writer, http.DefaultClient)
+
+	err := cli.Run(finder, []string{
+		"--urls-from", list,
+		"--image-hosts", "127.0.0.1",
+		"--no-cache",
+		"--manifest=false",
+		"--out", "memes",
+		"--name-template", "{{.Index}}-{{.ID1}}{{.Ext}}",
+	}, env(nil), io.Discard, io.Discard)
+	require.NoError(t, err)
+
+	assert.Len(t, writer.Files(), 2)
+	assert.Contains(t, writer.Files(), "memes/1-"+memes[1].ID1+".png")
+	assert.Contains(t, writer.Files(), "memes/2-"+memes[0].ID1+".jpg")
+}
+
+func TestRunShowsEmbeddedProvenance(t *testing.T) {
+	server, fake := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	writer := catscrapertest.NewFileSystem()
+	finder := imgfinder.New(imgfinder.CheezburgerScrapper{}, writer, http.DefaultClient)
+	site := []string{"--site", server.URL, "--image-hosts", "127.0.0.1", "--no-cache", "--amount", "1"}
+
+	require.NoError(t, cli.Run(finder, append(site, "--out", "embedded", "--embed-provenance"), env(nil), io.Discard, io.Discard))
+	require.NoError(t, cli.Run(finder, []string{"show-meta", "embedded/1.jpg"}, env(nil), io.Discard, io.Discard))
+
+	provenance, err := finder.ReadProvenance("embedded/1.jpg")
+	require.NoError(t, err)
+	meme := fake.Memes()[0]
+	assert.Equal(t, fmt.Sprintf("%s/full/%s/%s", server.URL, meme.ID1, meme.ID2), provenance.SourceURL)
+
+	require.NoError(t, cli.Run(finder, append(site, "--out", "plain"), env(nil), io.Discard, io.Discard))
+	err = cli.Run(finder, []string{"show-meta", "plain/1.jpg", "missing.jpg"}, env(nil), io.Discard, io.Discard)
+	require.EqualError(t, err, "couldn't read the provenance of 2 files")
+
+	err = cli.Run(finder, []string{"show-meta"}, env(nil), io.Discard, io.Discard)
+	require.EqualError(t, err, "missing arguments, expected FILE...")
+}
+
+func TestRunRejectsInvalidSettings(t *testing.T) {
+	finder := imgfinder.New(imgfinder.CheezburgerScrapper{}, catscrapertest.NewFileSystem(), catscrapertest.NewGetter())
+
+	err := cli.Run(finder, []string{"--threads", "0"}, env(nil), io.Discard, io.Discard)
+	require.EqualError(t, err, "invalid threads 0, expected 1 to 5")
+}
+
+func TestRunLibraryCommands(t *testing.T) {
+	server, _ := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	writer := catscrapertest.NewFileSystem()
+	finder := imgfinder.New(imgfinder.CheezburgerScrapper{}, writer, http.DefaultClient)
+	site := []string{"--site", server.URL, "--image-hosts", "127.0.0.1", "--no-cache"}
+
+	// download is the default command
+	require.NoError(t, cli.Run(finder, append(site, "--amount", "3", "--out", "memes"), env(nil), io.Discard, io.Discard))
+	require.NoError(t, cli.Run(finder, []string{"verify", "--out", "memes"}, env(nil), io.Discard, io.Discard))
+	require.NoError(t, cli.Run(finder, []string{"stats", "--out", "memes"}, env(nil), io.Discard, io.Discard))
+
+	require.NoError(t, writer.WriteFile("memes/2.png", []byte("corrupted"), 0666))
+	require.NoError(t, writer.WriteFile("memes/4.jpg.part", []byte("interrupted"), 0666))
+
+	err := cli.Run(finder, []string{"verify", "--out", "memes"}, env(nil), io.Discard, io.Discard)
+	require.EqualError(t, err, "found 1 problems in memes")
+
+	require.NoError(t, cli.Run(finder, []string{"verify", "--out", "memes", "--repair", "--no-cache"}, env(nil), io.Discard, io.Discard))
+	require.NoError(t, cli.Run(finder, []string{"verify", "--out", "memes"}, env(nil), io.Discard, io.Discard))
+
+	require.NoError(t, cli.Run(finder, []string{"clean", "--out", "memes"}, env(nil), io.Discard, io.Discard))
+	assert.NotContains(t, writer.Files(), "memes/4.jpg.part")
+
+	// Commands only have their own flags
+	err = cli.Run(finder, []string{"stats", "--amount", "3"}, env(nil), io.Discard, io.Discard)
+	require.EqualError(t, err, "flag provided but not defined: -amount")
+
+	err = cli.Run(finder, []string{"fetch"}, env(nil), io.Discard, io.Discard)
+	require.EqualError(t, err, "unknown command 'fetch', expected one of download, list, verify, stats, clean, show-meta")
+}
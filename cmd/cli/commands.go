@@ -0,0 +1,289 @@
+package cli
+
+import (
+	"cat-scraper/internal/imgfinder"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultCommand runs when no command is given, as before there were commands
+const defaultCommand = "download"
+
+// A command is a subcommand of the program
+type command struct {
+	name        string
+	description string
+	// args are the arguments the command takes after the flags, e.g.
+	// FILE..., empty if it takes none
+	args  string
+	flags []flagGroup
+	run   func(finder imgfinder.Finder, config Config, stdout io.Writer, stderr io.Writer) error
+}
+
+// commands are the commands of the program, in the order of the usage
+var commands = []command{
+	{
+		name:        "download",
+		description: "Download memes to a library (the default command).",
+		flags:       []flagGroup{sourceFlags, clientFlags, filterFlags, libraryFlags, downloadFlags},
+		run:         download,
+	},
+	{
+		name:        "list",
+		description: "Print the memes that would be downloaded, one JSON object per line, without downloading them.",
+		flags:       []flagGroup{sourceFlags, clientFlags, filterFlags},
+		run:         list,
+	},
+	{
+		name:        "verify",
+		description: "Check the memes of a library against its manifest, and optionally repair them.",
+		flags:       []flagGroup{libraryFlags, clientFlags, verifyFlags},
+		run:         verify,
+	},
+	{
+		name:        "stats",
+		description: "Summarize the memes of a library.",
+		flags:       []flagGroup{libraryFlags},
+		run:         stats,
+	},
+	{
+		name:        "clean",
+		description: "Remove the partial and temporary files left in a library by interrupted runs.",
+		flags:       []flagGroup{libraryFlags, cleanFlags},
+		run:         clean,
+	},
+	{
+		name:        "show-meta",
+		description: "Print the provenance embedded in memes saved with --embed-provenance.",
+		args:        "FILE...",
+		run:         showMeta,
+	},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+
+	return command{}, false
+}
+
+func commandNames() []string {
+	var names []string
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+
+	return names
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: cat-scraper [command] [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(w, "\nRun cat-scraper [command] -h for the flags of a command.\n")
+}
+
+func list(finder imgfinder.Finder, config Config, stdout io.Writer, stderr io.Writer) error {
+	quotas, err := parseSiteQuotas(config)
+	if err != nil {
+		return err
+	}
+
+	// Only the memes go to stdout, so they can be piped into other tools
+	finder, err = withSource(finder, config, stderr)
+	if err != nil {
+		return err
+	}
+
+	// Memes are listed like dry runs print them, so either can be downloaded
+	// with --urls-from
+	planned, err := finder.PlanImages(quotas)
+	if err != nil {
+		return err
+	}
+
+	return printPlan(planned, stdout)
+}
+
+// printPlan prints where memes would be saved to w, one JSON object per line
+func printPlan(planned []imgfinder.PlannedImage, w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	for _, image := range planned {
+		err := encoder.Encode(image.Ref())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func verify(finder imgfinder.Finder, config Config, stdout io.Writer, stderr io.Writer) error {
+	finder, dir, err := withLibrary(finder, config)
+	if err != nil {
+		return err
+	}
+
+	problems, err := finder.VerifyLibrary(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range problems {
+		fmt.Fprintln(stdout, problem)
+	}
+
+	if len(problems) == 0 {
+		fmt.Fprintf(stdout, "Every meme of %s matches its manifest\n", config.Out)
+		return nil
+	}
+
+	if !config.Repair {
+		return fmt.Errorf("found %d problems in %s", len(problems), config.Out)
+	}
+
+	// Memes are saved again with the settings in the manifest, only the
+	// client is the one of the flags
+	finder, err = withProfile(finder, config, stdout)
+	if err != nil {
+		return err
+	}
+
+	repaired, err := finder.RepairLibrary(dir, problems)
+	for _, path := range repaired {
+		fmt.Fprintln(stdout, "Repaired", path)
+	}
+
+	return err
+}
+
+func showMeta(finder imgfinder.Finder, config Config, stdout io.Writer, stderr io.Writer) error {
+	failed := 0
+	for _, file := range config.Files {
+		provenance, err := finder.ReadProvenance(file)
+		if err != nil {
+			fmt.Fprintf(stdout, "%s: %s\n", file, err)
+			failed++
+			continue
+		}
+
+		fmt.Fprintf(stdout, "%s:\n", file)
+		fmt.Fprintf(stdout, "  Source: %s\n", provenance.SourceURL)
+		if provenance.Title != "" {
+			fmt.Fprintf(stdout, "  Title: %s\n", provenance.Title)
+		}
+		if provenance.Site != "" {
+			fmt.Fprintf(stdout, "  Site: %s\n", provenance.Site)
+		}
+		fmt.Fprintf(stdout, "  Downloaded: %s\n", provenance.DownloadedAt.Format(time.RFC3339))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("couldn't read the provenance of %d files", failed)
+	}
+
+	return nil
+}
+
+func stats(finder imgfinder.Finder, config Config, stdout io.Writer, stderr io.Writer) error {
+	finder, dir, err := withLibrary(finder, config)
+	if err != nil {
+		return err
+	}
+
+	library, err := finder.LibraryStats(dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Memes: %d (%s)\n", library.Images, formatBytes(library.Bytes))
+	fmt.Fprintf(stdout, "Thumbnails: %d\n", library.Thumbnails)
+	fmt.Fprintf(stdout, "Sites: %s\n", formatCounts(library.Sites))
+
+	sections := map[string]int{}
+	for section, count := range library.Sections {
+		sections[string(section)] = count
+	}
+	fmt.Fprintf(stdout, "Sections: %s\n", formatCounts(sections))
+	fmt.Fprintf(stdout, "Formats: %s\n", formatCounts(library.Types))
+
+	if !library.FirstDownloaded.IsZero() {
+		fmt.Fprintf(stdout, "Downloaded: %s to %s\n", library.FirstDownloaded.Format(time.RFC3339), library.LastDownloaded.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func clean(finder imgfinder.Finder, config Config, stdout io.Writer, stderr io.Writer) error {
+	finder, dir, err := withLibrary(finder, config)
+	if err != nil {
+		return err
+	}
+
+	removed, err := finder.CleanLibrary(dir, config.DryRun)
+	for _, file := range removed {
+		if config.DryRun {
+			fmt.Fprintln(stdout, "Would remove", file)
+		} else {
+			fmt.Fprintln(stdout, "Removed", file)
+		}
+	}
+
+	return err
+}
+
+// formatCounts formats counts by name from the highest, e.g. "feed 3, hot 1"
+func formatCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+
+	var names []string
+	for name := range counts {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+
+		return names[i] < names[j]
+	})
+
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s %d", name, counts[name]))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// formatBytes formats a size in the largest unit it has at least one of
+func formatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	value := float64(bytes) / unit
+	suffix := "KiB"
+	for _, larger := range []string{"MiB", "GiB"} {
+		if value < unit {
+			break
+		}
+
+		value /= unit
+		suffix = larger
+	}
+
+	return fmt.Sprintf("%.1f %s", value, suffix)
+}
@@ -0,0 +1,487 @@
+package cli
+
+import (
+	"bytes"
+	"cat-scraper/internal/imgfinder"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of the environment variables of the settings. The
+// rest of the name is the flag in upper case with underscores, e.g.
+// CATSCRAPER_CACHE_DIR for --cache-dir.
+const EnvPrefix = "CATSCRAPER_"
+
+// MaxThreads is the most threads memes can be downloaded with
+const MaxThreads = 5
+
+// Config are the settings of a run. They are taken, from lowest to highest
+// priority, from the defaults, the config file, the environment and the
+// flags. The keys of the config file are the flags with underscores.
+type Config struct {
+	Amount  int    `yaml:"amount"`
+	Threads int    `yaml:"threads"`
+	Site    string `yaml:"site"`
+	From    string `yaml:"from"`
+	// URLsFrom is a file with the memes to download instead of scrapping
+	// them, - for stdin
+	URLsFrom string `yaml:"urls_from"`
+	Record   string `yaml:"record"`
+	Replay   string `yaml:"replay"`
+	Out      string `yaml:"out"`
+
+	NoCache   bool          `yaml:"no_cache"`
+	CacheDir  string        `yaml:"cache_dir"`
+	CacheSize int           `yaml:"cache_size"`
+	CacheTTL  time.Duration `yaml:"cache_ttl"`
+
+	ConnectTimeout        time.Duration     `yaml:"connect_timeout"`
+	TLSTimeout            time.Duration     `yaml:"tls_timeout"`
+	ResponseHeaderTimeout time.Duration     `yaml:"response_header_timeout"`
+	Timeout               time.Duration     `yaml:"timeout"`
+	Proxy                 string            `yaml:"proxy"`
+	UserAgent             string            `yaml:"user_agent"`
+	Headers               map[string]string `yaml:"headers,omitempty"`
+	CABundle              string            `yaml:"ca_bundle"`
+	MaxIdleConns          int               `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost   int               `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int               `yaml:"max_conns_per_host"`
+	ImageHosts            string            `yaml:"image_hosts"`
+
+	Size string `yaml:"size"`
+
+	MinWidth  int    `yaml:"min_width"`
+	MinHeight int    `yaml:"min_height"`
+	Aspect    string `yaml:"aspect"`
+	MinBytes  int    `yaml:"min_bytes"`
+	MaxBytes  int    `yaml:"max_bytes"`
+
+	Sections string   `yaml:"sections"`
+	Include  []string `yaml:"include,omitempty"`
+	Exclude  []string `yaml:"exclude,omitempty"`
+
+	Verbose bool `yaml:"verbose"`
+
+	Thumbs    string `yaml:"thumbs"`
+	ThumbsGIF string `yaml:"thumbs_gif"`
+
+	ConvertTo  string `yaml:"convert_to"`
+	Quality    int    `yaml:"quality"`
+	Background string `yaml:"background"`
+	ConvertGIF string `yaml:"convert_gif"`
+
+	Manifest        bool `yaml:"manifest"`
+	EmbedProvenance bool `yaml:"embed_provenance"`
+	StripMetadata   bool `yaml:"strip_metadata"`
+
+	OnConflict   string `yaml:"on_conflict"`
+	Continue     bool   `yaml:"continue"`
+	NameTemplate string `yaml:"name_template"`
+
+	DryRun bool `yaml:"dry_run"`
+	Repair bool `yaml:"repair"`
+
+	// PrintConfig is whether to print the settings instead of running
+	PrintConfig bool `yaml:"-"`
+	// Files are the arguments of commands that take files
+	Files []string `yaml:"-"`
+}
+
+// DefaultConfig returns the settings used when nothing else is set
+func DefaultConfig() Config {
+	profile := imgfinder.DefaultClientProfile
+
+	return Config{
+		Amount:  10,
+		Threads: 1,
+		Site:    imgfinder.DefaultSite.Name,
+		Out:     "images/",
+
+		CacheSize: 500,
+
+		ConnectTimeout:        profile.ConnectTimeout,
+		TLSTimeout:            profile.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: profile.ResponseHeaderTimeout,
+		Timeout:               profile.Timeout,
+		UserAgent:             profile.UserAgent,
+		MaxIdleConns:          profile.MaxIdleConns,
+		MaxIdleConnsPerHost:   profile.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       profile.MaxConnsPerHost,
+
+		Size:      string(imgfinder.SizeLargestAvailable),
+		Sections:  "feed,hot,lists",
+		ThumbsGIF: string(imgfinder.GIFFirstFrame),
+
+		Quality:    imgfinder.DefaultJPEGQuality,
+		Background: "#ffffff",
+		ConvertGIF: string(imgfinder.GIFConvertFirstFrame),
+
+		Manifest: true,
+
+		OnConflict:   string(imgfinder.ConflictOverwrite),
+		NameTemplate: imgfinder.DefaultNameTemplate,
+	}
+}
+
+// flagGroup is a group of flags that commands share
+type flagGroup int
+
+const (
+	// sourceFlags are where memes are found
+	sourceFlags flagGroup = iota
+	// clientFlags are how pages and memes are requested
+	clientFlags
+	// filterFlags choose memes by what the pages say about them
+	filterFlags
+	// libraryFlags are where memes are saved
+	libraryFlags
+	// downloadFlags are how memes are downloaded and saved
+	downloadFlags
+	// verifyFlags are the flags of verifying a library
+	verifyFlags
+	// cleanFlags are the flags of cleaning a library
+	cleanFlags
+)
+
+// flagSet returns the flags of a command with the given groups, which set
+// the fields of c
+func (c *Config) flagSet(name string, configPath *string, groups []flagGroup) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+
+	fs.StringVar(configPath, "config", "", "YAML file with the settings, which the environment and flags override")
+	fs.BoolVar(&c.PrintConfig, "print-config", false, "print the settings as a config file and exit, without doing anything else")
+
+	for _, group := range groups {
+		switch group {
+		case sourceFlags:
+			fs.IntVar(&c.Amount, "amount", c.Amount, "how many memes to download")
+			fs.StringVar(&c.Site, "site", c.Site, "Cheezburger network site to download memes from: a known site name (e.g. memebase) or a url")
+			fs.StringVar(&c.From, "from", c.From, "comma separated sites with how many memes to download from each, e.g. icanhas:20,memebase:10 (overrides --site and --amount)")
+		case clientFlags:
+			fs.StringVar(&c.Record, "record", c.Record, "directory to save every page and image response to, so the run can be replayed with --replay")
+			fs.StringVar(&c.Replay, "replay", c.Replay, "directory with the responses saved by --record to replay the run from, without going online")
+			fs.BoolVar(&c.NoCache, "no-cache", c.NoCache, "don't cache pages and images between runs")
+			fs.StringVar(&c.CacheDir, "cache-dir", c.CacheDir, "directory to cache pages and images in (Default: cat-scraper in the user cache directory)")
+			fs.IntVar(&c.CacheSize, "cache-size", c.CacheSize, "size limit of the cache, in megabytes (0: no limit)")
+			fs.DurationVar(&c.CacheTTL, "cache-ttl", c.CacheTTL, "how long cached responses are used without revalidating them, e.g. 1h (Default: what the site says)")
+			fs.DurationVar(&c.ConnectTimeout, "connect-timeout", c.ConnectTimeout, "how long connecting to a host can take")
+			fs.DurationVar(&c.TLSTimeout, "tls-timeout", c.TLSTimeout, "how long the TLS handshake can take")
+			fs.DurationVar(&c.ResponseHeaderTimeout, "response-header-timeout", c.ResponseHeaderTimeout, "how long the headers of a response can take")
+			fs.DurationVar(&c.Timeout, "timeout", c.Timeout, "how long a whole request can take, including the body (0: no limit)")
+			fs.StringVar(&c.Proxy, "proxy", c.Proxy, "url of the HTTP(S) proxy to make requests through (Default: HTTP_PROXY and HTTPS_PROXY)")
+			fs.StringVar(&c.UserAgent, "user-agent", c.UserAgent, "User-Agent of every request")
+			fs.Var(&headerFlag{headers: &c.Headers}, "header", "extra header of every request, as 'Name: value' (repeatable)")
+			fs.StringVar(&c.CABundle, "ca-bundle", c.CABundle, "PEM file with certificate authorities to trust besides the ones of the system")
+			fs.IntVar(&c.MaxIdleConns, "max-idle-conns", c.MaxIdleConns, "how many idle connections are kept (0: no limit)")
+			fs.IntVar(&c.MaxIdleConnsPerHost, "max-idle-conns-per-host", c.MaxIdleConnsPerHost, "how many idle connections are kept per host")
+			fs.IntVar(&c.MaxConnsPerHost, "max-conns-per-host", c.MaxConnsPerHost, "how many connections can be open per host (0: no limit)")
+			fs.StringVar(&c.ImageHosts, "image-hosts", c.ImageHosts, "comma separated hosts memes are downloaded from, e.g. to scrap a fake site (Default: i.chzbgr.com)")
+		case filterFlags:
+			fs.IntVar(&c.MinWidth, "min-width", c.MinWidth, "minimum width of the memes to save, in pixels")
+			fs.IntVar(&c.MinHeight, "min-height", c.MinHeight, "minimum height of the memes to save, in pixels")
+			fs.StringVar(&c.Aspect, "aspect", c.Aspect, "aspect ratio of the memes to save: W:H, MIN-MAX, MIN- or -MAX (e.g. 4:3-16:9)")
+			fs.StringVar(&c.Sections, "sections", c.Sections, "comma separated sections of the page to save memes from: feed, hot and lists")
+			fs.Var(&listFlag{values: &c.Include}, "include", "only save memes whose title, alt text or slug match a keyword or /regexp/ (repeatable)")
+			fs.Var(&listFlag{values: &c.Exclude}, "exclude", "skip memes whose title, alt text or slug match a keyword or /regexp/ (repeatable)")
+			fs.BoolVar(&c.Verbose, "verbose", c.Verbose, "explain why every skipped meme was skipped")
+		case libraryFlags:
+			fs.StringVar(&c.Out, "out", c.Out, "where to save the memes, a local directory or an s3://bucket/prefix location")
+		case downloadFlags:
+			fs.IntVar(&c.Threads, "threads", c.Threads, fmt.Sprintf("number of threads that will download images concurrently (max: %d)", MaxThreads))
+			fs.StringVar(&c.Size, "size", c.Size, "size of the memes to download: full, thumbN (e.g. thumb800) or largest-available")
+			fs.IntVar(&c.MinBytes, "min-bytes", c.MinBytes, "minimum file size of the memes to save")
+			fs.IntVar(&c.MaxBytes, "max-bytes", c.MaxBytes, "maximum file size of the memes to save")
+			fs.StringVar(&c.Thumbs, "thumbs", c.Thumbs, "comma separated widths of thumbnails to generate for every meme, e.g. 200,800")
+			fs.StringVar(&c.ThumbsGIF, "thumbs-gif", c.ThumbsGIF, "how to make thumbnails of animated gifs: first-frame or all-frames")
+			fs.StringVar(&c.ConvertTo, "convert-to", c.ConvertTo, "format to convert every meme to: jpeg or png (Default: keep the downloaded format)")
+			fs.IntVar(&c.Quality, "quality", c.Quality, "quality of converted jpegs, from 1 to 100")
+			fs.StringVar(&c.Background, "background", c.Background, "color transparent pixels are flattened onto when converting to jpeg")
+			fs.StringVar(&c.ConvertGIF, "convert-gif", c.ConvertGIF, "how to convert animated gifs: first-frame or keep")
+			fs.BoolVar(&c.Manifest, "manifest", c.Manifest, "record the saved memes in a manifest.json in the output directory")
+			fs.BoolVar(&c.EmbedProvenance, "embed-provenance", c.EmbedProvenance, "embed where every meme comes from in the saved file, see the show-meta command")
+			fs.BoolVar(&c.StripMetadata, "strip-metadata", c.StripMetadata, "remove EXIF, XMP and IPTC metadata from jpegs and text chunks from pngs, reporting memes with location data")
+			fs.StringVar(&c.OnConflict, "on-conflict", c.OnConflict, "what to do when a meme already exists: skip, overwrite, rename or fail")
+			fs.BoolVar(&c.Continue, "continue", c.Continue, "number memes after the highest number of the ones already saved")
+			fs.StringVar(&c.NameTemplate, "name-template", c.NameTemplate, "text/template used to name saved memes (fields: Index, ID1, ID2, Slug, Title, Date, Site, Ext)")
+			fs.StringVar(&c.URLsFrom, "urls-from", c.URLsFrom, "file with the meme URLs or listed memes to download instead of scrapping the site, - for stdin")
+			fs.BoolVar(&c.DryRun, "dry-run", c.DryRun, "only print the memes that would be downloaded, one JSON object per line. Their filename has no extension unless --convert-to is set.")
+		case verifyFlags:
+			fs.BoolVar(&c.Repair, "repair", c.Repair, "download the missing, mismatched and corrupt memes again from where they were saved from")
+		case cleanFlags:
+			fs.BoolVar(&c.DryRun, "dry-run", c.DryRun, "only print the files that would be removed")
+		}
+	}
+
+	return fs
+}
+
+// LoadConfig returns the settings of a command with the given command line
+// arguments (after the command name) and environment. Only the settings of
+// the command can be set with flags and environment variables.
+func LoadConfig(command string, args []string, lookupEnv func(string) (string, bool)) (Config, error) {
+	return loadConfig(command, args, lookupEnv, os.Stderr)
+}
+
+// loadConfig is LoadConfig printing the usage and the flag errors to output
+func loadConfig(command string, args []string, lookupEnv func(string) (string, bool), output io.Writer) (Config, error) {
+	cmd, ok := findCommand(command)
+	if !ok {
+		return Config{}, fmt.Errorf("unknown command '%s', expected one of %s", command, strings.Join(commandNames(), ", "))
+	}
+
+	config := DefaultConfig()
+
+	var configPath string
+	fs := config.flagSet(cmd.name, &configPath, cmd.flags)
+	fs.SetOutput(output)
+	usage := "cat-scraper " + cmd.name + " [flags]"
+	if cmd.args != "" {
+		usage += " " + cmd.args
+	}
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s\n\n%s\n\nFlags:\n", usage, cmd.description)
+		fs.PrintDefaults()
+	}
+
+	// The config file is read before the flags, which override it
+	path, ok := configFlag(args)
+	if !ok {
+		path, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+
+	if path != "" {
+		err := config.loadFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "print-config" || envErr != nil {
+			return
+		}
+
+		name := EnvPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		value, ok := lookupEnv(name)
+		if !ok {
+			return
+		}
+
+		err := fs.Set(f.Name, value)
+		if err != nil {
+			envErr = fmt.Errorf("invalid value '%s' of %s: %s", value, name, err)
+		}
+	})
+	if envErr != nil {
+		return Config{}, envErr
+	}
+
+	startLayer(fs)
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+
+	switch {
+	case cmd.args == "" && fs.NArg() > 0:
+		return Config{}, fmt.Errorf("unexpected argument '%s'", fs.Arg(0))
+	case cmd.args != "" && fs.NArg() == 0:
+		return Config{}, fmt.Errorf("missing arguments, expected %s", cmd.args)
+	}
+
+	if cmd.args != "" {
+		config.Files = fs.Args()
+	}
+
+	return config, config.Validate()
+}
+
+// configFlag returns the value of --config in args, if it's there
+func configFlag(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+
+		if hasValue {
+			return value, true
+		}
+
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+
+	return "", false
+}
+
+func (c *Config) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %s", err)
+	}
+
+	// Unknown keys are most likely typos
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+
+	err = decoder.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing config file %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// Validate checks the settings that aren't checked when they are used
+func (c Config) Validate() error {
+	switch {
+	case c.From == "" && c.Amount < 1:
+		return fmt.Errorf("invalid amount %d, expected 1 or more", c.Amount)
+	case c.Threads < 1 || c.Threads > MaxThreads:
+		return fmt.Errorf("invalid threads %d, expected 1 to %d", c.Threads, MaxThreads)
+	case c.Record != "" && c.Replay != "":
+		return fmt.Errorf("record and replay can't be used together")
+	case c.Out == "":
+		return fmt.Errorf("invalid empty out, expected a directory or s3://bucket/prefix")
+	case c.CacheSize < 0:
+		return fmt.Errorf("invalid cache size %d, expected 0 or more megabytes", c.CacheSize)
+	case c.MinWidth < 0 || c.MinHeight < 0:
+		return fmt.Errorf("invalid negative minimum dimensions %dx%d", c.MinWidth, c.MinHeight)
+	case c.MinBytes < 0 || c.MaxBytes < 0:
+		return fmt.Errorf("invalid negative file size bounds")
+	case c.MaxBytes != 0 && c.MinBytes > c.MaxBytes:
+		return fmt.Errorf("invalid file size bounds, min bytes %d is more than max bytes %d", c.MinBytes, c.MaxBytes)
+	case c.Quality < 1 || c.Quality > 100:
+		return fmt.Errorf("invalid quality %d, expected 1 to 100", c.Quality)
+	}
+
+	return nil
+}
+
+// String returns the settings as a config file
+func (c Config) String() string {
+	content, err := yaml.Marshal(c)
+	if err != nil {
+		// Settings are always plain values
+		panic(err)
+	}
+
+	return string(content)
+}
+
+// clientProfile returns the client profile of the settings
+func (c Config) clientProfile() imgfinder.ClientProfile {
+	return imgfinder.ClientProfile{
+		ConnectTimeout:        c.ConnectTimeout,
+		TLSHandshakeTimeout:   c.TLSTimeout,
+		ResponseHeaderTimeout: c.ResponseHeaderTimeout,
+		Timeout:               c.Timeout,
+		Proxy:                 c.Proxy,
+		UserAgent:             c.UserAgent,
+		Headers:               c.Headers,
+		CABundle:              c.CABundle,
+		MaxIdleConns:          c.MaxIdleConns,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+	}
+}
+
+// startLayer makes the repeatable flags of fs replace their values the next
+// time they are set
+func startLayer(fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if layered, ok := f.Value.(layeredFlag); ok {
+			layered.startLayer()
+		}
+	})
+}
+
+// A layeredFlag is a repeatable flag. The values of a layer (the environment
+// or the command line) replace the ones of the lower layers instead of adding
+// to them, so startLayer is called before every layer.
+type layeredFlag interface {
+	startLayer()
+}
+
+// listFlag is a flag that can be repeated to add many values
+type listFlag struct {
+	values *[]string
+	// set is whether the current layer set any value
+	set bool
+}
+
+func (l *listFlag) String() string {
+	if l == nil || l.values == nil {
+		return ""
+	}
+
+	return strings.Join(*l.values, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	if !l.set {
+		*l.values = nil
+		l.set = true
+	}
+
+	*l.values = append(*l.values, value)
+	return nil
+}
+
+func (l *listFlag) startLayer() {
+	l.set = false
+}
+
+// headerFlag is a flag that can be repeated to set many headers
+type headerFlag struct {
+	headers *map[string]string
+	// set is whether the current layer set any header
+	set bool
+}
+
+func (h *headerFlag) String() string {
+	if h == nil || h.headers == nil {
+		return ""
+	}
+
+	var pairs []string
+	for name, value := range *h.headers {
+		pairs = append(pairs, name+": "+value)
+	}
+
+	return strings.Join(pairs, ", ")
+}
+
+func (h *headerFlag) Set(value string) error {
+	name, headerValue, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid header '%s', expected 'Name: value'", value)
+	}
+
+	if !h.set {
+		*h.headers = map[string]string{}
+		h.set = true
+	}
+
+	(*h.headers)[strings.TrimSpace(name)] = strings.TrimSpace(headerValue)
+	return nil
+}
+
+func (h *headerFlag) startLayer() {
+	h.set = false
+}
@@ -0,0 +1,134 @@
+package cli_test
+
+import (
+	"cat-scraper/cmd/cli"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "cat-scraper.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0666))
+
+	return path
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	config, err := cli.LoadConfig("download", nil, env(nil))
+	require.NoError(t, err)
+	assert.Equal(t, cli.DefaultConfig(), config)
+	assert.Equal(t, "images/", config.Out)
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	path := writeConfig(t, `
+amount: 20
+threads: 2
+out: from-file/
+cache_ttl: 1h
+include: [cat]
+headers:
+  X-Team: memes
+`)
+
+	config, err := cli.LoadConfig("download",
+		[]string{"--config", path, "--threads", "4", "--include", "dog"},
+		env(map[string]string{"CATSCRAPER_THREADS": "3", "CATSCRAPER_OUT": "from-env/", "CATSCRAPER_NO_CACHE": "true"}),
+	)
+	require.NoError(t, err)
+
+	// The file overrides the defaults
+	assert.Equal(t, 20, config.Amount)
+	assert.Equal(t, time.Hour, config.CacheTTL)
+	assert.Equal(t, map[string]string{"X-Team": "memes"}, config.Headers)
+	// The environment overrides the file
+	assert.Equal(t, "from-env/", config.Out)
+	assert.True(t, config.NoCache)
+	// The flags override everything
+	assert.Equal(t, 4, config.Threads)
+	// Repeatable settings replace the ones of the file
+	assert.Equal(t, []string{"dog"}, config.Include)
+}
+
+func TestLoadConfigRepeatableLayers(t *testing.T) {
+	path := writeConfig(t, `
+include: [cat]
+exclude: [dog]
+headers:
+  X-Team: memes
+`)
+
+	config, err := cli.LoadConfig("download",
+		[]string{"--config", path, "--include", "kitten", "--include", "/grumpy/", "--header", "X-Run: 1", "--header", "X-Debug: yes"},
+		env(map[string]string{"CATSCRAPER_INCLUDE": "lion", "CATSCRAPER_EXCLUDE": "wolf"}),
+	)
+	require.NoError(t, err)
+
+	// The environment replaces the file, and the flags replace both, adding
+	// up their own values
+	assert.Equal(t, []string{"kitten", "/grumpy/"}, config.Include)
+	assert.Equal(t, []string{"wolf"}, config.Exclude)
+	assert.Equal(t, map[string]string{"X-Run": "1", "X-Debug": "yes"}, config.Headers)
+}
+
+func TestLoadConfigFileFromEnvironment(t *testing.T) {
+	path := writeConfig(t, "amount: 7\n")
+
+	config, err := cli.LoadConfig("download", nil, env(map[string]string{"CATSCRAPER_CONFIG": path}))
+	require.NoError(t, err)
+	assert.Equal(t, 7, config.Amount)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+		err  string
+	}{
+		{name: "threads out of range", args: []string{"--threads", "9"}, err: "invalid threads 9, expected 1 to 5"},
+		{name: "invalid environment", env: map[string]string{"CATSCRAPER_AMOUNT": "many"}, err: `invalid value 'many' of CATSCRAPER_AMOUNT: parse error`},
+		{name: "record and replay", args: []string{"--record", "a", "--replay", "b"}, err: "record and replay can't be used together"},
+		{name: "file size bounds", args: []string{"--min-bytes", "10", "--max-bytes", "5"}, err: "invalid file size bounds, min bytes 10 is more than max bytes 5"},
+		{name: "unknown key", file: "threds: 2\n", err: "yaml: unmarshal errors:\n  line 1: field threds not found in type cli.Config"},
+		{name: "stray argument", args: []string{"memes"}, err: "unexpected argument 'memes'"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			args := test.args
+			if test.file != "" {
+				args = append([]string{"--config", writeConfig(t, test.file)}, args...)
+			}
+
+			_, err := cli.LoadConfig("download", args, env(test.env))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.err)
+		})
+	}
+}
+
+func TestConfigStringIsAConfigFile(t *testing.T) {
+	config, err := cli.LoadConfig("download", []string{"--amount", "3", "--cache-ttl", "90m"}, env(nil))
+	require.NoError(t, err)
+
+	printed := cli.DefaultConfig()
+	require.NoError(t, yaml.Unmarshal([]byte(config.String()), &printed))
+	assert.Equal(t, config, printed)
+}
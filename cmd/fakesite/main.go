@@ -0,0 +1,38 @@
+// Command fakesite serves a fake Cheezburger site, to try the scrapper without
+// going online:
+//
+//	go run ./cmd/fakesite --addr localhost:8080
+//	go run main.go --site http://localhost:8080 --image-hosts localhost
+package main
+
+import (
+	"cat-scraper/internal/fakesite"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+var (
+	addr         = flag.String("addr", "localhost:8080", "address to listen on")
+	pages        = flag.Int("pages", 3, "pages of the feed")
+	postsPerPage = flag.Int("posts-per-page", 8, "posts of every page of the feed, not counting sponsored posts")
+	baseURL      = flag.String("base-url", "", "url the site is reachable at (Default: the host of every request)")
+)
+
+func main() {
+	flag.Parse()
+
+	if *pages < 1 || *postsPerPage < 1 {
+		log.Fatal("--pages and --posts-per-page must be at least 1")
+	}
+
+	site := fakesite.New(fakesite.Config{
+		Pages:        *pages,
+		PostsPerPage: *postsPerPage,
+		BaseURL:      *baseURL,
+	})
+
+	fmt.Printf("Serving a fake Cheezburger site with %d memes on http://%s/\n", len(site.Memes()), *addr)
+	log.Fatal(http.ListenAndServe(*addr, site))
+}
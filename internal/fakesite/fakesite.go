@@ -0,0 +1,253 @@
+// Package fakesite is a fake Cheezburger site, with a feed that has the same
+// markup as the real one, so the real scrapper can be tested end to end
+// without going online.
+//
+// Every page of the feed has memes, list article covers, a sponsored post and
+// ads between posts. The first page also has the "Hot today" panel, with
+// thumbnails of posts of the feed. Images are served by the site itself and
+// are generated deterministically from their ids.
+package fakesite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+)
+
+// Config configures the content of a site. Zero values use the defaults.
+type Config struct {
+	// Pages of the feed (Default: 3)
+	Pages int
+	// PostsPerPage are the posts of every page, counting memes and list
+	// articles but not sponsored posts (Default: 8)
+	PostsPerPage int
+	// BaseURL is the URL the site is reachable at, used in the links and
+	// image URLs of the pages. Empty means the host of every request.
+	BaseURL string
+}
+
+// Kind is the kind of a post
+type Kind string
+
+const (
+	// KindMeme is a post with a single meme
+	KindMeme Kind = "meme"
+	// KindList is a list article, of which the feed only shows the cover
+	KindList Kind = "list"
+	// KindSponsored is a sponsored post
+	KindSponsored Kind = "sponsored"
+)
+
+// A Post is a post of the feed
+type Post struct {
+	ID1  string
+	ID2  string
+	Slug string
+
+	Title string
+	Kind  Kind
+
+	Width       int
+	Height      int
+	ContentType string
+}
+
+// Site is a fake Cheezburger site. It is an http.Handler.
+type Site struct {
+	config Config
+	pages  [][]Post
+}
+
+// New creates a site with the posts of config
+func New(config Config) *Site {
+	if config.Pages == 0 {
+		config.Pages = 3
+	}
+
+	if config.PostsPerPage == 0 {
+		config.PostsPerPage = 8
+	}
+
+	config.BaseURL = strings.TrimSuffix(config.BaseURL, "/")
+
+	site := &Site{config: config}
+	for page := 0; page < config.Pages; page++ {
+		site.pages = append(site.pages, site.makePage(page))
+	}
+
+	return site
+}
+
+// NewServer starts a site on a local server, with the URL of the server as
+// its base URL. It should be closed when no longer used.
+func NewServer(config Config) (*httptest.Server, *Site) {
+	var site *Site
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		site.ServeHTTP(w, r)
+	}))
+
+	config.BaseURL = server.URL
+	site = New(config)
+
+	return server, site
+}
+
+var contentTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+func (s *Site) makePage(page int) []Post {
+	var posts []Post
+	for i := 0; i < s.config.PostsPerPage; i++ {
+		n := page*s.config.PostsPerPage + i
+
+		post := Post{
+			ID1:         strconv.Itoa(9700000000 + n),
+			ID2:         fmt.Sprintf("h%08X", uint32(n)*2654435761),
+			Slug:        fmt.Sprintf("meme-number-%d", n+1),
+			Title:       fmt.Sprintf("Meme number %d", n+1),
+			Kind:        KindMeme,
+			Width:       400 + (n%5)*100,
+			Height:      300 + (n%3)*100,
+			ContentType: contentTypes[n%len(contentTypes)],
+		}
+
+		// Every fourth post is a list article
+		if i%4 == 3 {
+			post.Kind = KindList
+			post.Slug = fmt.Sprintf("list-number-%d", n+1)
+			post.Title = fmt.Sprintf("%d Memes For List Number %d", 10+n, n+1)
+			post.Width, post.Height = 800, 420
+		}
+
+		posts = append(posts, post)
+
+		// A sponsored post after the second one
+		if i == 1 {
+			posts = append(posts, Post{
+				ID1:         strconv.Itoa(9800000000 + page),
+				ID2:         fmt.Sprintf("hAD%05X", page),
+				Slug:        "buy-premium-cat-food",
+				Title:       "Your Cat Deserves Premium Food",
+				Kind:        KindSponsored,
+				Width:       600,
+				Height:      400,
+				ContentType: "image/jpeg",
+			})
+		}
+	}
+
+	return posts
+}
+
+// Posts returns the posts of every page of the feed, in order
+func (s *Site) Posts() []Post {
+	var posts []Post
+	for _, page := range s.pages {
+		posts = append(posts, page...)
+	}
+
+	return posts
+}
+
+// Memes returns the posts with a single meme, in order
+func (s *Site) Memes() []Post {
+	var memes []Post
+	for _, post := range s.Posts() {
+		if post.Kind == KindMeme {
+			memes = append(memes, post)
+		}
+	}
+
+	return memes
+}
+
+// post returns the post with the given ids
+func (s *Site) post(id1 string, id2 string) (Post, bool) {
+	for _, post := range s.Posts() {
+		if post.ID1 == id1 && post.ID2 == id2 {
+			return post, true
+		}
+	}
+
+	return Post{}, false
+}
+
+func (s *Site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	baseURL := s.config.BaseURL
+	if baseURL == "" {
+		baseURL = "http://" + r.Host
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+
+	switch {
+	case path == "":
+		s.serveFeed(w, baseURL, 1)
+	case len(parts) == 2 && parts[0] == "page":
+		page, err := strconv.Atoi(parts[1])
+		if err != nil || page < 1 {
+			http.NotFound(w, r)
+			return
+		}
+
+		s.serveFeed(w, baseURL, page)
+	case len(parts) == 3 || len(parts) == 4:
+		// Images are {size}/{id1}/{id2}, with an optional slug
+		s.serveImage(w, r, parts[0], parts[1], parts[2])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Site) serveFeed(w http.ResponseWriter, baseURL string, page int) {
+	if page > len(s.pages) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<!DOCTYPE html><html><body><h1>Not Found</h1></body></html>")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, s.feedHTML(baseURL, page))
+}
+
+func (s *Site) serveImage(w http.ResponseWriter, r *http.Request, size string, id1 string, id2 string) {
+	post, ok := s.post(id1, id2)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	width := post.Width
+	if size != "full" {
+		thumbnail, err := strconv.Atoi(strings.TrimPrefix(size, "thumb"))
+		if err != nil || !strings.HasPrefix(size, "thumb") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if thumbnail < width {
+			width = thumbnail
+		}
+	}
+
+	// Images never change, like in the real CDN
+	etag := fmt.Sprintf(`"%s-%d"`, post.ID2, width)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	content, err := Image(post, width)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", post.ContentType)
+	w.Write(content)
+}
@@ -0,0 +1,173 @@
+package fakesite
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+)
+
+// placeholder is the src of lazy loaded images until they are loaded
+const placeholder = "data:image/gif;base64,R0lGODlhAQABAAAAACH5BAEAAAAALAAAAAABAAEAAAI="
+
+// adImageURL is an image of an ad network, which isn't a meme
+const adImageURL = "https://ads.example.com/creatives/300x250/cat-food.jpg"
+
+// feedPost is a post as rendered in the feed
+type feedPost struct {
+	Post
+	URL      string
+	ImageURL string
+	// Lazy is whether the image is lazy loaded
+	Lazy bool
+	// AdAfter is whether an ad goes after the post
+	AdAfter bool
+}
+
+func (p feedPost) Padding() string {
+	return fmt.Sprintf("%.2f%%", float64(p.Height)*100/float64(p.Width))
+}
+
+type feedPage struct {
+	Posts []feedPost
+	// Hot are the posts of the "Hot today" panel
+	Hot         []feedPost
+	AdImageURL  string
+	Placeholder template.URL
+}
+
+var feedTemplate = template.Must(template.New("feed").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>I Can Has Cheezburger? - Funny Cats | Cat Meme | Cat Pictures</title>
+</head>
+<body class="mu-animal">
+<div class="mu-container mu-content">
+        <div class="mu-ad-container mu-leaderboard">
+                <div class="mu-ad" id="mu-leaderboard-ad"><img class="resp-media" src="{{.AdImageURL}}" width="728" height="90"/></div>
+        </div>
+<div class="mu-col-container">
+    <div>
+{{range .Posts}}
+{{if eq .Kind "list"}}
+<div class="mu-content-card mu-card mu-flush mu-z1 js-post" data-post="{{.ID1}}" data-post-url="{{.URL}}">
+        <script class="js-post-data" type="application/json">
+{"id":{{.ID1}},"url":"{{.URL}}","title":"{{.Title}}","author":"FakeAuthor","partial":false}
+    </script>
+        <a href="{{.URL}}">
+            <div class="mu-post mu-thumbnail resp-media-wrap" style="padding-bottom: 52.5%;">
+                <img class="resp-media lazyload" src="{{$.Placeholder}}" data-src="{{.ImageURL}}" alt="list of memes | thumbnail for {{.Title}}" title="{{.Title}}" width="{{.Width}}" height="{{.Height}}"/>
+            </div>
+        </a>
+    <div class="mu-post-title mu-section mu-inset">
+        <h1>
+            <a href="{{.URL}}" title="{{.Title}} - I Can Has Cheezburger? - Cheezburger">{{.Title}}</a>
+        </h1>
+    </div>
+        <div class="mu-view-post mu-section">
+            <a class="mu-btn mu-filled mu-theme" href="{{.URL}}">View List</a>
+        </div>
+</div>
+{{else}}
+<div class="mu-content-card mu-card mu-flush mu-z1 js-post" data-post="{{.ID1}}" data-post-url="{{.URL}}">
+        <script class="js-post-data" type="application/json">
+{"id":{{.ID1}},"url":"{{.URL}}","title":"{{.Title}}","author":"FakeAuthor","partial":false}
+    </script>
+{{if eq .Kind "sponsored"}}
+    <div class="mu-post-label mu-section mu-inset"><span>Sponsored</span></div>
+{{end}}
+    <div class="mu-post-title mu-section mu-inset">
+        <h1>
+            <a href="{{.URL}}" title="{{.Title}} - I Can Has Cheezburger? - Cheezburger">{{.Title}}</a>
+        </h1>
+    </div>
+        <div class="mu-post mu-section">
+        <a href="{{.URL}}" title="{{.Title}}">
+{{if .Lazy}}
+            <div class="resp-media-wrap" style="padding-bottom: {{.Padding}};"> <img class='resp-media lazyload' src="{{$.Placeholder}}" data-src='{{.ImageURL}}' id='_r_a_{{.ID1}}' width="{{.Width}}" height="{{.Height}}" alt="Cheezburger Image {{.ID1}}" title="{{.Title}}" /> <noscript> <img class='resp-media' src='{{.ImageURL}}' id='_r_a_{{.ID1}}' width="{{.Width}}" height="{{.Height}}" alt="Cheezburger Image {{.ID1}}" title="{{.Title}}" /> </noscript> </div>
+{{else}}
+            <div class="resp-media-wrap" style="padding-bottom: {{.Padding}};"> <img class='resp-media' src='{{.ImageURL}}' id='_r_a_{{.ID1}}' width="{{.Width}}" height="{{.Height}}" alt="Cheezburger Image {{.ID1}}" title="{{.Title}}" /> </div>
+{{end}}
+        </a>
+        </div>
+</div>
+{{end}}
+{{if .AdAfter}}
+            <div class="ad-label">Advertisement</div>
+        <div class="mu-ad-container mu-250">
+                <div class="mu-ad" id="mu-stream-ad-{{.ID1}}"><img class="resp-media" src="{{$.AdImageURL}}" width="300" height="250"/></div>
+        </div>
+{{end}}
+{{end}}
+    </div>
+    <div class="mu-right">
+{{if .Hot}}
+    <div class="mu-card mu-panel mu-flush mu-hot-today">
+        <h2 class="mu-title">
+            Hot Today
+        </h2>
+        <div class="mu-tabs">
+            <div class="mu-tab">
+                    <div class="mu-items">
+{{range .Hot}}
+                            <a href="{{.URL}}">
+                                <div class="resp-media-wrap" style="padding-bottom: 52.5%">
+                                    <img class="resp-media lazyload" src="{{$.Placeholder}}" data-src="{{.ImageURL}}"/>
+                                </div>
+                                {{.Title}}
+                            </a>
+{{end}}
+                    </div>
+            </div>
+        </div>
+    </div>
+{{end}}
+        <img class="resp-media" src="{{.AdImageURL}}" width="300" height="600"/>
+    </div>
+</div>
+</div>
+</body>
+</html>
+`))
+
+func (s *Site) feedHTML(baseURL string, page int) string {
+	data := feedPage{AdImageURL: adImageURL, Placeholder: placeholder}
+
+	for i, post := range s.pages[page-1] {
+		rendered := feedPost{
+			Post:     post,
+			URL:      fmt.Sprintf("%s/%s/%s", baseURL, post.ID1, post.Slug),
+			ImageURL: fmt.Sprintf("%s/full/%s/%s/%s", baseURL, post.ID1, post.ID2, post.Slug),
+			// Only the first posts load with the page
+			Lazy:    i >= 2,
+			AdAfter: i%3 == 2,
+		}
+
+		if post.Kind == KindList {
+			rendered.ImageURL = fmt.Sprintf("%s/thumb800/%s/%s/%s", baseURL, post.ID1, post.ID2, post.Slug)
+		}
+
+		data.Posts = append(data.Posts, rendered)
+	}
+
+	// Hot today has thumbnails of the first memes, and is only on the first
+	// page
+	if page == 1 {
+		for _, post := range s.Memes() {
+			if len(data.Hot) == 3 {
+				break
+			}
+
+			data.Hot = append(data.Hot, feedPost{
+				Post:     post,
+				URL:      fmt.Sprintf("%s/%s/%s", baseURL, post.ID1, post.Slug),
+				ImageURL: fmt.Sprintf("%s/thumb400/%s/%s/%s", baseURL, post.ID1, post.ID2, post.Slug),
+			})
+		}
+	}
+
+	var html bytes.Buffer
+	// The template and its data are known to be valid
+	_ = feedTemplate.Execute(&html, data)
+
+	return html.String()
+}
@@ -0,0 +1,48 @@
+package fakesite
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strconv"
+)
+
+// Image returns the image of a post at the given width, keeping the aspect
+// ratio. It's always the same for the same post and width.
+func Image(post Post, width int) ([]byte, error) {
+	height := post.Height * width / post.Width
+	if height < 1 {
+		height = 1
+	}
+
+	// Every post has its own color, taken from its id
+	id, _ := strconv.Atoi(post.ID1)
+	fill := color.RGBA{R: uint8(id * 37), G: uint8(id * 91), B: uint8(id * 53), A: 255}
+
+	img := image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9)
+	index := uint8(img.Palette.Index(fill))
+	for i := range img.Pix {
+		img.Pix[i] = index
+	}
+
+	var encoded bytes.Buffer
+	var err error
+
+	switch post.ContentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&encoded, img, nil)
+	case "image/png":
+		err = png.Encode(&encoded, img)
+	case "image/gif":
+		err = gif.Encode(&encoded, img, nil)
+	default:
+		err = fmt.Errorf("unexpected content type '%s'", post.ContentType)
+	}
+
+	return encoded.Bytes(), err
+}
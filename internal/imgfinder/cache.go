@@ -0,0 +1,350 @@
+package imgfinder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The cache is a directory with responses to GET requests, saved like in a
+// cassette: {key}.json with the status, headers and when the response was
+// stored, and {key}.body with the body. The modification time of the body is
+// when the response was last used, to evict the least recently used ones.
+
+// cacheEntry is the metadata of a cached response
+type cacheEntry struct {
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	StoredAt   time.Time   `json:"stored_at"`
+}
+
+// CachingTransport is an http.RoundTripper that caches responses on disk in
+// Dir. Fresh responses are answered from the cache, stale ones are revalidated
+// with If-None-Match and If-Modified-Since, and a 304 Not Modified answer is a
+// cache hit. Requests are made with Next, or http.DefaultTransport if it's
+// nil.
+type CachingTransport struct {
+	Dir  string
+	Next http.RoundTripper
+	// MaxBytes is the size limit of the bodies in the cache. The least
+	// recently used responses are evicted when it's exceeded. Zero means no
+	// limit.
+	MaxBytes int64
+	// TTL, if not zero, is how long responses are fresh, instead of what
+	// their Cache-Control and Expires headers say
+	TTL time.Duration
+	// Now returns the current time. Nil means time.Now.
+	Now func() time.Time
+}
+
+func (t CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return next.RoundTrip(req)
+	}
+
+	key := requestKey(req)
+	entry, body, cached := t.load(key)
+
+	if cached && t.fresh(entry) {
+		t.touch(key)
+		return entry.response(req, body), nil
+	}
+
+	outgoing := req
+	if cached {
+		outgoing = conditionalRequest(req, entry)
+	}
+
+	resp, err := next.RoundTrip(outgoing)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+
+		// The answer may update the headers, like the expiration
+		for name, values := range resp.Header {
+			entry.Header[name] = values
+		}
+		entry.StoredAt = t.now()
+
+		err = t.save(key, entry, body)
+		if err != nil {
+			return nil, fmt.Errorf("caching %s: %s", req.URL, err)
+		}
+
+		return entry.response(req, body), nil
+	}
+
+	if resp.StatusCode != http.StatusOK || hasDirective(resp.Header, "no-store") {
+		return resp, nil
+	}
+
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %s", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	entry = cacheEntry{
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		StoredAt:   t.now(),
+	}
+
+	err = t.save(key, entry, body)
+	if err != nil {
+		return nil, fmt.Errorf("caching %s: %s", req.URL, err)
+	}
+
+	err = t.evict()
+	if err != nil {
+		return nil, fmt.Errorf("evicting cached responses: %s", err)
+	}
+
+	return resp, nil
+}
+
+func (t CachingTransport) now() time.Time {
+	if t.Now == nil {
+		return time.Now()
+	}
+
+	return t.Now()
+}
+
+// fresh is whether a cached response can be used without revalidating it
+func (t CachingTransport) fresh(entry cacheEntry) bool {
+	age := t.now().Sub(entry.StoredAt)
+
+	if t.TTL != 0 {
+		return age < t.TTL
+	}
+
+	if hasDirective(entry.Header, "no-cache") {
+		return false
+	}
+
+	if maxAge, ok := directiveSeconds(entry.Header, "max-age"); ok {
+		return age < time.Duration(maxAge)*time.Second
+	}
+
+	// Without max-age, responses are fresh until they expire
+	expires, err := http.ParseTime(entry.Header.Get("Expires"))
+	if err != nil {
+		return false
+	}
+
+	date, err := http.ParseTime(entry.Header.Get("Date"))
+	if err != nil {
+		date = entry.StoredAt
+	}
+
+	return age < expires.Sub(date)
+}
+
+// conditionalRequest is req asking for the body only if it changed since the
+// cached response
+func conditionalRequest(req *http.Request, entry cacheEntry) *http.Request {
+	conditional := req.Clone(req.Context())
+
+	if etag := entry.Header.Get("ETag"); etag != "" && req.Header.Get("If-None-Match") == "" {
+		conditional.Header.Set("If-None-Match", etag)
+	}
+
+	if modified := entry.Header.Get("Last-Modified"); modified != "" && req.Header.Get("If-Modified-Since") == "" {
+		conditional.Header.Set("If-Modified-Since", modified)
+	}
+
+	return conditional
+}
+
+func (e cacheEntry) response(req *http.Request, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// load returns the cached response of a request, if there is one. Responses
+// that can't be read, for example because they are being evicted, are not
+// cached.
+func (t CachingTransport) load(key string) (cacheEntry, []byte, bool) {
+	metadata, err := os.ReadFile(filepath.Join(t.Dir, key+".json"))
+	if err != nil {
+		return cacheEntry{}, nil, false
+	}
+
+	var entry cacheEntry
+	err = json.Unmarshal(metadata, &entry)
+	if err != nil || entry.Header == nil {
+		return cacheEntry{}, nil, false
+	}
+
+	body, err := os.ReadFile(filepath.Join(t.Dir, key+".body"))
+	if err != nil {
+		return cacheEntry{}, nil, false
+	}
+
+	return entry, body, true
+}
+
+func (t CachingTransport) save(key string, entry cacheEntry, body []byte) error {
+	err := os.MkdirAll(t.Dir, 0777)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The body goes first, so the metadata is never read without it
+	err = writeFileAtomically(filepath.Join(t.Dir, key+".body"), body)
+	if err != nil {
+		return err
+	}
+
+	t.touch(key)
+
+	return writeFileAtomically(filepath.Join(t.Dir, key+".json"), metadata)
+}
+
+// touch marks a cached response as used now
+func (t CachingTransport) touch(key string) {
+	now := t.now()
+	// Failing only makes the response more likely to be evicted
+	_ = os.Chtimes(filepath.Join(t.Dir, key+".body"), now, now)
+}
+
+// evict removes the least recently used responses until the cache fits in
+// MaxBytes
+func (t CachingTransport) evict() error {
+	if t.MaxBytes == 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(t.Dir)
+	if err != nil {
+		return err
+	}
+
+	var bodies []os.FileInfo
+	var total int64
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".body") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since it was listed
+			continue
+		}
+
+		bodies = append(bodies, info)
+		total += info.Size()
+	}
+
+	sort.Slice(bodies, func(i, j int) bool {
+		return bodies[i].ModTime().Before(bodies[j].ModTime())
+	})
+
+	for _, body := range bodies {
+		if total <= t.MaxBytes {
+			break
+		}
+
+		key := strings.TrimSuffix(body.Name(), ".body")
+		for _, name := range []string{key + ".json", key + ".body"} {
+			err := os.Remove(filepath.Join(t.Dir, name))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		total -= body.Size()
+	}
+
+	return nil
+}
+
+// writeFileAtomically writes a file so it's never read half written
+func writeFileAtomically(name string, data []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
+}
+
+// hasDirective is whether the Cache-Control header has a directive
+func hasDirective(header http.Header, directive string) bool {
+	_, ok := cacheDirective(header, directive)
+	return ok
+}
+
+// directiveSeconds returns the seconds of a Cache-Control directive like
+// max-age=60
+func directiveSeconds(header http.Header, directive string) (int, bool) {
+	value, ok := cacheDirective(header, directive)
+	if !ok {
+		return 0, false
+	}
+
+	seconds, err := strconv.Atoi(strings.Trim(value, `"`))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return seconds, true
+}
+
+func cacheDirective(header http.Header, directive string) (string, bool) {
+	for _, line := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			if strings.EqualFold(name, directive) {
+				return value, true
+			}
+		}
+	}
+
+	return "", false
+}
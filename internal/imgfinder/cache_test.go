@@ -0,0 +1,172 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/internal/imgfinder"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// origin is a server that answers with a response per URL and remembers the
+// requests it got
+type origin struct {
+	responses map[string]func(req *http.Request) *http.Response
+	requests  []*http.Request
+}
+
+func (o *origin) RoundTrip(req *http.Request) (*http.Response, error) {
+	o.requests = append(o.requests, req)
+	return o.responses[req.URL.String()](req), nil
+}
+
+func originResponse(status int, header http.Header, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// clock is a fake time.Now
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func getBody(t *testing.T, transport http.RoundTripper, url string) string {
+	t.Helper()
+
+	resp, err := (&http.Client{Transport: transport}).Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return string(body)
+}
+
+func TestCachesFreshResponses(t *testing.T) {
+	server := &origin{responses: map[string]func(*http.Request) *http.Response{
+		"https://example.com/": func(*http.Request) *http.Response {
+			return originResponse(http.StatusOK, http.Header{"Cache-Control": {"public, max-age=60"}}, "page")
+		},
+	}}
+	now := &clock{now: time.Date(2023, 2, 3, 12, 0, 0, 0, time.UTC)}
+	transport := imgfinder.CachingTransport{Dir: t.TempDir(), Next: server, Now: now.Now}
+
+	assert.Equal(t, "page", getBody(t, transport, "https://example.com/"))
+	now.now = now.now.Add(59 * time.Second)
+	assert.Equal(t, "page", getBody(t, transport, "https://example.com/"))
+	assert.Len(t, server.requests, 1)
+
+	// Expired, so it's requested again
+	now.now = now.now.Add(time.Second)
+	assert.Equal(t, "page", getBody(t, transport, "https://example.com/"))
+	assert.Len(t, server.requests, 2)
+}
+
+func TestRevalidatesStaleResponses(t *testing.T) {
+	server := &origin{responses: map[string]func(*http.Request) *http.Response{
+		"https://example.com/full/1/hA": func(req *http.Request) *http.Response {
+			if req.Header.Get("If-None-Match") == `"v1"` {
+				return originResponse(http.StatusNotModified, http.Header{}, "")
+			}
+
+			return originResponse(http.StatusOK, http.Header{
+				"Cache-Control": {"no-cache"},
+				"Etag":          {`"v1"`},
+				"Last-Modified": {"Fri, 03 Feb 2023 10:00:00 GMT"},
+				"Content-Type":  {"image/jpeg"},
+			}, "meme")
+		},
+	}}
+	transport := imgfinder.CachingTransport{Dir: t.TempDir(), Next: server}
+
+	assert.Equal(t, "meme", getBody(t, transport, "https://example.com/full/1/hA"))
+	assert.Equal(t, "meme", getBody(t, transport, "https://example.com/full/1/hA"))
+
+	require.Len(t, server.requests, 2)
+	assert.Equal(t, "", server.requests[0].Header.Get("If-None-Match"))
+	assert.Equal(t, `"v1"`, server.requests[1].Header.Get("If-None-Match"))
+	assert.Equal(t, "Fri, 03 Feb 2023 10:00:00 GMT", server.requests[1].Header.Get("If-Modified-Since"))
+}
+
+func TestDoesNotCacheNoStore(t *testing.T) {
+	server := &origin{responses: map[string]func(*http.Request) *http.Response{
+		"https://example.com/": func(*http.Request) *http.Response {
+			return originResponse(http.StatusOK, http.Header{"Cache-Control": {"no-store, max-age=60"}}, "page")
+		},
+	}}
+	dir := t.TempDir()
+	transport := imgfinder.CachingTransport{Dir: dir, Next: server}
+
+	getBody(t, transport, "https://example.com/")
+	getBody(t, transport, "https://example.com/")
+	assert.Len(t, server.requests, 2)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCacheTTLOverridesHeaders(t *testing.T) {
+	server := &origin{responses: map[string]func(*http.Request) *http.Response{
+		"https://example.com/": func(*http.Request) *http.Response {
+			return originResponse(http.StatusOK, http.Header{"Cache-Control": {"no-cache"}}, "page")
+		},
+	}}
+	now := &clock{now: time.Date(2023, 2, 3, 12, 0, 0, 0, time.UTC)}
+	transport := imgfinder.CachingTransport{Dir: t.TempDir(), Next: server, TTL: time.Hour, Now: now.Now}
+
+	getBody(t, transport, "https://example.com/")
+	now.now = now.now.Add(30 * time.Minute)
+	getBody(t, transport, "https://example.com/")
+	assert.Len(t, server.requests, 1)
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	server := &origin{responses: map[string]func(*http.Request) *http.Response{}}
+	for _, path := range []string{"a", "b", "c"} {
+		body := strings.Repeat(path, 4)
+		server.responses["https://example.com/"+path] = func(*http.Request) *http.Response {
+			return originResponse(http.StatusOK, http.Header{"Cache-Control": {"max-age=3600"}}, body)
+		}
+	}
+
+	now := &clock{now: time.Date(2023, 2, 3, 12, 0, 0, 0, time.UTC)}
+	dir := t.TempDir()
+	transport := imgfinder.CachingTransport{Dir: dir, Next: server, MaxBytes: 8, Now: now.Now}
+
+	getBody(t, transport, "https://example.com/a")
+	now.now = now.now.Add(time.Second)
+	getBody(t, transport, "https://example.com/b")
+	now.now = now.now.Add(time.Second)
+	// Using a makes b the least recently used
+	getBody(t, transport, "https://example.com/a")
+	now.now = now.now.Add(time.Second)
+	getBody(t, transport, "https://example.com/c")
+	assert.Len(t, server.requests, 3)
+
+	bodies, err := filepath.Glob(filepath.Join(dir, "*.body"))
+	require.NoError(t, err)
+	assert.Len(t, bodies, 2)
+
+	getBody(t, transport, "https://example.com/a")
+	getBody(t, transport, "https://example.com/c")
+	assert.Len(t, server.requests, 3)
+
+	assert.Equal(t, "bbbb", getBody(t, transport, "https://example.com/b"))
+	assert.Len(t, server.requests, 4)
+}
@@ -0,0 +1,136 @@
+package imgfinder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// A cassette is a directory with recorded HTTP responses, so runs can be
+// replayed offline. Every response is saved as two files named after its
+// request: {key}.json with the request, status and headers, and {key}.body
+// with the body.
+
+// cassetteInteraction is the metadata of a recorded response
+type cassetteInteraction struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+}
+
+// requestKey is the name of the files of a request in a cassette or cache
+func requestKey(req *http.Request) string {
+	return sha256Hex([]byte(req.Method + " " + req.URL.String()))[:32]
+}
+
+// RecordingTransport is an http.RoundTripper that saves every response to
+// the cassette in Dir. Requests are made with Next, or
+// http.DefaultTransport if it's nil.
+type RecordingTransport struct {
+	Dir  string
+	Next http.RoundTripper
+}
+
+func (t RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %s", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	interaction := cassetteInteraction{
+		Method:     req.Method,
+		URL:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+	}
+
+	err = t.save(requestKey(req), interaction, body)
+	if err != nil {
+		return nil, fmt.Errorf("recording %s: %s", req.URL, err)
+	}
+
+	return resp, nil
+}
+
+func (t RecordingTransport) save(key string, interaction cassetteInteraction, body []byte) error {
+	err := os.MkdirAll(t.Dir, 0777)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The metadata goes last, so an interrupted recording never leaves a
+	// response that's replayed with a partial body
+	err = writeFileAtomically(filepath.Join(t.Dir, key+".body"), body)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(filepath.Join(t.Dir, key+".json"), metadata)
+}
+
+// ReplayTransport is an http.RoundTripper that answers requests with the
+// responses recorded in the cassette in Dir, without making any request.
+// Requests that weren't recorded fail.
+type ReplayTransport struct {
+	Dir string
+}
+
+func (t ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := requestKey(req)
+
+	metadata, err := os.ReadFile(filepath.Join(t.Dir, key+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s %s is not in the cassette %s", req.Method, req.URL, t.Dir)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("replaying %s: %s", req.URL, err)
+	}
+
+	var interaction cassetteInteraction
+	err = json.Unmarshal(metadata, &interaction)
+	if err != nil {
+		return nil, fmt.Errorf("replaying %s: parsing %s.json: %s", req.URL, key, err)
+	}
+
+	body, err := os.ReadFile(filepath.Join(t.Dir, key+".body"))
+	if err != nil {
+		return nil, fmt.Errorf("replaying %s: %s", req.URL, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.StatusCode, http.StatusText(interaction.StatusCode)),
+		StatusCode:    interaction.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        interaction.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
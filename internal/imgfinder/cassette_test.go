@@ -0,0 +1,74 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runWithTransport(site imgfinder.Site, transport http.RoundTripper) (*catscrapertest.FileSystem, error) {
+	scrapper := imgfinder.CheezburgerScrapper{ImageHosts: []string{"127.0.0.1"}, Transport: transport}
+	writer := catscrapertest.NewFileSystem()
+
+	finder := imgfinder.New(scrapper, writer, &http.Client{Transport: transport}).WithSite(site)
+
+	return writer, finder.CollectAndDownloadImages(1, 1, "images")
+}
+
+func TestRecordsAndReplaysRuns(t *testing.T) {
+	server := catscrapertest.NewSite()
+	server.Page("/", `<img class="resp-media lazyload" src="data:image/gif;base64,R0lGODlhAQABAAAAACH5BAEAAAAALAAAAAABAAEAAAI=" data-src="`+server.URL+`/thumb800/1/hA/meme"/>`)
+	server.Handle("/full/1/hA", catscrapertest.Response{Content: []byte("meme"), ContentType: "image/jpeg"})
+
+	site := imgfinder.Site{Name: "local", BaseURL: server.URL + "/"}
+	cassette := t.TempDir()
+
+	recorded, err := runWithTransport(site, imgfinder.RecordingTransport{Dir: cassette})
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"images/1.jpg": []byte("meme")}, recorded.Files())
+
+	// Responses are written to temporary files first, and none are left
+	entries, err := os.ReadDir(cassette)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.Contains(t, []string{".json", ".body"}, filepath.Ext(entry.Name()))
+	}
+
+	// The site is gone, everything comes from the cassette
+	server.Close()
+
+	replayed, err := runWithTransport(site, imgfinder.ReplayTransport{Dir: cassette})
+	require.NoError(t, err)
+	assert.Equal(t, recorded.Files(), replayed.Files())
+}
+
+func TestReplayMissingResponse(t *testing.T) {
+	client := &http.Client{Transport: imgfinder.ReplayTransport{Dir: "testdata/empty-cassette"}}
+
+	_, err := client.Get("https://icanhas.cheezburger.com/")
+	require.EqualError(t, err, `Get "https://icanhas.cheezburger.com/": GET https://icanhas.cheezburger.com/ is not in the cassette testdata/empty-cassette`)
+}
+
+func TestReplaysStatusAndHeaders(t *testing.T) {
+	server := catscrapertest.NewSite()
+	server.Handle("/missing", catscrapertest.Response{
+		StatusCode: http.StatusNotFound,
+		Header:     http.Header{"X-Cache": {"MISS"}},
+	})
+
+	cassette := t.TempDir()
+	_, err := (&http.Client{Transport: imgfinder.RecordingTransport{Dir: cassette}}).Get(server.URL + "/missing")
+	require.NoError(t, err)
+	server.Close()
+
+	resp, err := (&http.Client{Transport: imgfinder.ReplayTransport{Dir: cassette}}).Get(server.URL + "/missing")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "MISS", resp.Header.Get("X-Cache"))
+}
@@ -0,0 +1,158 @@
+package imgfinder
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// ClientProfile is how requests are made, both to scrap pages and to download
+// images
+type ClientProfile struct {
+	// ConnectTimeout is how long connecting to a host can take
+	ConnectTimeout time.Duration
+	// TLSHandshakeTimeout is how long the TLS handshake can take
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout is how long the headers of a response can take,
+	// after the request is sent
+	ResponseHeaderTimeout time.Duration
+	// Timeout is how long a whole request can take, including reading the
+	// body. Zero means no limit.
+	Timeout time.Duration
+
+	// Proxy is the URL of the HTTP(S) proxy requests go through. Empty means
+	// the proxy of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+	// variables.
+	Proxy string
+
+	// UserAgent is the User-Agent of every request, unless it's empty
+	UserAgent string
+	// Headers are extra headers sent with every request
+	Headers map[string]string
+
+	// CABundle is a PEM file with certificate authorities to trust besides
+	// the ones of the system
+	CABundle string
+
+	// MaxIdleConns is how many idle connections are kept, in total. Zero means
+	// no limit.
+	MaxIdleConns int
+	// MaxIdleConnsPerHost is how many idle connections are kept per host
+	MaxIdleConnsPerHost int
+	// MaxConnsPerHost is how many connections can be open per host. Zero
+	// means no limit.
+	MaxConnsPerHost int
+}
+
+// DefaultClientProfile makes sure a hung connection doesn't stall a download
+// forever
+var DefaultClientProfile = ClientProfile{
+	ConnectTimeout:        10 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: 30 * time.Second,
+	Timeout:               2 * time.Minute,
+	UserAgent:             "cat-scraper",
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   10,
+}
+
+// NewTransport returns a transport that makes requests as the profile says.
+// Only the total timeout is left out, it must be set in the client or
+// scrapper.
+func (p ClientProfile) NewTransport() (http.RoundTripper, error) {
+	if p.ConnectTimeout < 0 || p.TLSHandshakeTimeout < 0 || p.ResponseHeaderTimeout < 0 || p.Timeout < 0 {
+		return nil, fmt.Errorf("invalid negative timeout")
+	}
+
+	if p.MaxIdleConns < 0 || p.MaxIdleConnsPerHost < 0 || p.MaxConnsPerHost < 0 {
+		return nil, fmt.Errorf("invalid negative connection limit")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: p.ConnectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = p.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = p.ResponseHeaderTimeout
+	transport.MaxIdleConns = p.MaxIdleConns
+	transport.MaxIdleConnsPerHost = p.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = p.MaxConnsPerHost
+
+	if p.Proxy != "" {
+		proxyURL, err := url.Parse(p.Proxy)
+		if err != nil || (proxyURL.Scheme != "http" && proxyURL.Scheme != "https") || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy '%s', expected an http or https url", p.Proxy)
+		}
+
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if p.CABundle != "" {
+		pool, err := loadCABundle(p.CABundle)
+		if err != nil {
+			return nil, err
+		}
+
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	if p.UserAgent == "" && len(p.Headers) == 0 {
+		return transport, nil
+	}
+
+	header := http.Header{}
+	for name, value := range p.Headers {
+		header.Set(name, value)
+	}
+
+	if p.UserAgent != "" {
+		header.Set("User-Agent", p.UserAgent)
+	}
+
+	return headerTransport{header: header, next: transport}, nil
+}
+
+// NewClient returns a client that makes requests with transport, with the
+// total timeout of the profile
+func (p ClientProfile) NewClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{Transport: transport, Timeout: p.Timeout}
+}
+
+// loadCABundle returns the certificate authorities of the system with the ones
+// of a PEM file
+func loadCABundle(name string) (*x509.CertPool, error) {
+	bundle, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("reading CA bundle: %s", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates in CA bundle '%s'", name)
+	}
+
+	return pool, nil
+}
+
+// headerTransport sets headers on every request
+type headerTransport struct {
+	header http.Header
+	next   http.RoundTripper
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests must not be modified, so the headers go in a copy
+	req = req.Clone(req.Context())
+	for name, values := range t.header {
+		req.Header[name] = values
+	}
+
+	return t.next.RoundTrip(req)
+}
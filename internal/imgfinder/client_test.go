@@ -0,0 +1,109 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/internal/imgfinder"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func profileClient(t *testing.T, profile imgfinder.ClientProfile) *http.Client {
+	t.Helper()
+
+	transport, err := profile.NewTransport()
+	require.NoError(t, err)
+
+	return profile.NewClient(transport)
+}
+
+func TestClientProfileSendsHeaders(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+	}))
+	defer server.Close()
+
+	profile := imgfinder.DefaultClientProfile
+	profile.UserAgent = "cat-scraper-test"
+	profile.Headers = map[string]string{"X-Team": "memes"}
+
+	resp, err := profileClient(t, profile).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, "cat-scraper-test", received.Get("User-Agent"))
+	assert.Equal(t, "memes", received.Get("X-Team"))
+}
+
+func TestClientProfileTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	profile := imgfinder.DefaultClientProfile
+	profile.ResponseHeaderTimeout = 50 * time.Millisecond
+
+	_, err := profileClient(t, profile).Get(server.URL)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout awaiting response headers")
+}
+
+func TestClientProfileGoesThroughProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+	}))
+	defer proxy.Close()
+
+	profile := imgfinder.DefaultClientProfile
+	profile.Proxy = proxy.URL
+
+	resp, err := profileClient(t, profile).Get("http://icanhas.cheezburger.com/")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, []string{"http://icanhas.cheezburger.com/"}, proxied)
+}
+
+func TestClientProfileTrustsCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// Unknown authority
+	_, err := profileClient(t, imgfinder.DefaultClientProfile).Get(server.URL)
+	require.Error(t, err)
+
+	bundle := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, os.WriteFile(bundle, certificate, 0666))
+
+	profile := imgfinder.DefaultClientProfile
+	profile.CABundle = bundle
+
+	resp, err := profileClient(t, profile).Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+}
+
+func TestClientProfileInvalid(t *testing.T) {
+	profile := imgfinder.DefaultClientProfile
+	profile.Proxy = "socks5://localhost:1080"
+	_, err := profile.NewTransport()
+	require.EqualError(t, err, "invalid proxy 'socks5://localhost:1080', expected an http or https url")
+
+	profile = imgfinder.DefaultClientProfile
+	profile.CABundle = filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(profile.CABundle, []byte("not a certificate"), 0666))
+	_, err = profile.NewTransport()
+	require.EqualError(t, err, "no certificates in CA bundle '"+profile.CABundle+"'")
+}
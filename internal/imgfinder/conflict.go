@@ -0,0 +1,216 @@
+package imgfinder
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A ConflictPolicy decides what to do when an image would be saved to a path
+// that already has an image from a previous run. Images with the same name
+// but different extension (1.jpg and 1.png) are considered the same.
+type ConflictPolicy string
+
+const (
+	// ConflictOverwrite replaces the existing image, removing the ones with
+	// other extensions so no stale images are left behind.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictSkip keeps the existing image and doesn't download the new one
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictRename saves the new image with a -2, -3, ... suffix
+	ConflictRename ConflictPolicy = "rename"
+	// ConflictFail stops with an error
+	ConflictFail ConflictPolicy = "fail"
+)
+
+// ConflictPolicies are all the valid conflict policies
+var ConflictPolicies = []ConflictPolicy{ConflictOverwrite, ConflictSkip, ConflictRename, ConflictFail}
+
+func ParseConflictPolicy(policy string) (ConflictPolicy, error) {
+	for _, p := range ConflictPolicies {
+		if string(p) == policy {
+			return p, nil
+		}
+	}
+
+	return "", fmt.Errorf("invalid conflict policy '%s', expected one of %v", policy, ConflictPolicies)
+}
+
+// errImageExists is returned by checkConflicts when the image shouldn't be
+// downloaded because of the skip policy
+var errImageExists = errors.New("image already exists")
+
+// checkConflicts is called before downloading an image, with the path where
+// it will be saved without the extension. It fails if the policy doesn't
+// allow saving the image.
+func (f Finder) checkConflicts(stem string, saver imageSaver) error {
+	if f.conflictPolicy != ConflictSkip && f.conflictPolicy != ConflictFail {
+		return nil
+	}
+
+	existing, err := f.existingVariants(stem, saver.reservations.isReserved)
+	if err != nil {
+		return err
+	}
+
+	if len(existing) == 0 {
+		return nil
+	}
+
+	if f.conflictPolicy == ConflictSkip {
+		return errImageExists
+	}
+
+	return fmt.Errorf("%s already exists", existing[0])
+}
+
+// reservePath reserves the path where an image will be saved, renaming it if
+// the policy says so. Images of the run named the same are suffixed under
+// every policy, with a suffix no saved image has.
+func (f Finder) reservePath(path string, saver imageSaver) (string, error) {
+	return saver.reservations.reserve(path, func(candidate string, isReserved func(string) bool) (bool, error) {
+		// The other policies already handled the images saved at path
+		if candidate == path && f.conflictPolicy != ConflictRename {
+			return false, nil
+		}
+
+		existing, err := f.existingVariants(strings.TrimSuffix(candidate, filepath.Ext(candidate)), isReserved)
+		return len(existing) > 0, err
+	})
+}
+
+// removeStaleVariants removes the images from previous runs saved at the same
+// path with other extensions, and their thumbnails.
+func (f Finder) removeStaleVariants(path string, saver imageSaver) error {
+	if f.conflictPolicy != ConflictOverwrite {
+		return nil
+	}
+
+	existing, err := f.existingVariants(strings.TrimSuffix(path, filepath.Ext(path)), saver.reservations.isReserved)
+	if err != nil {
+		return err
+	}
+
+	for _, stale := range existing {
+		if stale == path {
+			continue
+		}
+
+		err := f.fileSystem.Remove(stale)
+		if err != nil {
+			return fmt.Errorf("removing stale %s: %s", stale, err)
+		}
+
+		err = f.removeThumbnails(stale)
+		if err != nil {
+			return err
+		}
+
+		saver.manifest.remove(manifestPath(saver.basePath, stale))
+	}
+
+	return nil
+}
+
+// removeThumbnails removes the thumbnails of the image saved at imagePath
+func (f Finder) removeThumbnails(imagePath string) error {
+	dir := filepath.Dir(imagePath)
+	entries, err := f.fileSystem.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("reading %s: %s", dir, err)
+	}
+
+	for _, entry := range entries {
+		if _, ok := thumbnailWidth(filepath.ToSlash(imagePath), entry.Name()); entry.IsDir() || !ok {
+			continue
+		}
+
+		thumbnail := filepath.Join(dir, entry.Name())
+		err := f.fileSystem.Remove(thumbnail)
+		if err != nil {
+			return fmt.Errorf("removing stale %s: %s", thumbnail, err)
+		}
+	}
+
+	return nil
+}
+
+// existingVariants returns the images saved at stem with any extension,
+// ignoring the ones reserved during this run.
+func (f Finder) existingVariants(stem string, isReserved func(string) bool) ([]string, error) {
+	var existing []string
+	for _, ext := range imageExtensions() {
+		path := stem + ext
+		if isReserved(path) {
+			continue
+		}
+
+		exists, err := f.fileSystem.Exists(path)
+		if err != nil {
+			return nil, fmt.Errorf("checking if %s exists: %s", path, err)
+		}
+
+		if exists {
+			existing = append(existing, path)
+		}
+	}
+
+	return existing, nil
+}
+
+// highestIndex returns the highest number that images in dir start with, or 0
+// if there are none.
+func (f Finder) highestIndex(dir string) (int, error) {
+	entries, err := f.fileSystem.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("reading %s: %s", dir, err)
+	}
+
+	highest := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !isImageExtension(filepath.Ext(entry.Name())) {
+			continue
+		}
+
+		digits := strings.IndexFunc(entry.Name(), func(r rune) bool { return r < '0' || r > '9' })
+		index, err := strconv.Atoi(entry.Name()[:digits])
+		if err == nil && index > highest {
+			highest = index
+		}
+	}
+
+	return highest, nil
+}
+
+// imageExtensions returns the extensions of every image type we save
+func imageExtensions() []string {
+	var exts []string
+	for _, ext := range contentTypeToExt {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+
+	return exts
+}
+
+func isImageExtension(ext string) bool {
+	for _, imageExt := range imageExtensions() {
+		if ext == imageExt {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,198 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const conflictURL = "https://i.chzbgr.com/full/9730332160/h6860EF7A"
+
+// newConflictFinder returns a finder that downloads a single jpeg to a file
+// system where images/ already has the given files.
+func newConflictFinder(t *testing.T, existing map[string]string) (imgfinder.Finder, *catscrapertest.FileSystem, *catscrapertest.Getter) {
+	scrapper := MockScrapper{
+		URLsByPage: map[string][]string{
+			"https://icanhas.cheezburger.com/": {conflictURL},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle(conflictURL, catscrapertest.Response{Content: []byte("new"), ContentType: "image/jpeg", StatusCode: http.StatusOK})
+
+	writer := catscrapertest.NewFileSystem()
+	require.NoError(t, writer.MkdirAll("images", 0777))
+	for name, content := range existing {
+		require.NoError(t, writer.WriteFile(name, []byte(content), 0777))
+	}
+
+	return imgfinder.New(scrapper, writer, getter), writer, getter
+}
+
+func TestConflictOverwriteRemovesStaleExtensions(t *testing.T) {
+	finder, writer, _ := newConflictFinder(t, map[string]string{
+		"images/1.png": "old png",
+		"images/1.gif": "old gif",
+		"images/2.png": "other",
+	})
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{
+		"images/1.jpg": []byte("new"),
+		"images/2.png": []byte("other"),
+	}, writer.Files())
+}
+
+func TestConflictOverwriteRemovesStaleThumbnails(t *testing.T) {
+	finder, writer, _ := newConflictFinder(t, map[string]string{
+		"images/1.gif":           "old gif",
+		"images/1.thumb200.gif":  "old thumbnail",
+		"images/1.thumb400.gif":  "old thumbnail",
+		"images/10.thumb200.gif": "other thumbnail",
+	})
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{
+		"images/1.jpg":           []byte("new"),
+		"images/10.thumb200.gif": []byte("other thumbnail"),
+	}, writer.Files())
+}
+
+func TestConflictSkipDoesNotDownload(t *testing.T) {
+	finder, writer, getter := newConflictFinder(t, map[string]string{
+		"images/1.png": "old",
+	})
+
+	err := finder.WithConflictPolicy(imgfinder.ConflictSkip).CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Empty(t, getter.Requests())
+	assert.Equal(t, map[string][]byte{
+		"images/1.png": []byte("old"),
+	}, writer.Files())
+}
+
+func TestConflictSkipWithLongNames(t *testing.T) {
+	title := strings.Repeat("Very long title ", 10)
+
+	scrapper := MockScrapper{
+		ImagesByPage: map[string][]imgfinder.Image{
+			"https://icanhas.cheezburger.com/": {{URL: conflictURL, Title: title}},
+		},
+	}
+
+	namer, err := imgfinder.NewNamer("{{.Title}}{{.Ext}}")
+	require.NoError(t, err)
+
+	// The name is truncated to fit the extension
+	existing, err := namer.Name(imgfinder.NameData{Title: title, Ext: ".png"})
+	require.NoError(t, err)
+	require.True(t, len(existing) < len(title))
+
+	getter := catscrapertest.NewGetter()
+	writer := catscrapertest.NewFileSystem()
+	require.NoError(t, writer.MkdirAll("images", 0777))
+	require.NoError(t, writer.WriteFile("images/"+existing, []byte("old"), 0777))
+
+	finder := imgfinder.New(scrapper, writer, getter).
+		WithNamer(namer).
+		WithConflictPolicy(imgfinder.ConflictSkip).
+		WithManifest(false)
+
+	err = finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Empty(t, getter.Requests())
+	assert.Equal(t, map[string][]byte{"images/" + existing: []byte("old")}, writer.Files())
+}
+
+func TestConflictSkipSuffixesAroundSavedImages(t *testing.T) {
+	urls := []string{"https://i.chzbgr.com/full/1/h6860EF7A", "https://i.chzbgr.com/full/2/h6860EF7A"}
+	scrapper := MockScrapper{
+		ImagesByPage: map[string][]imgfinder.Image{
+			"https://icanhas.cheezburger.com/": {{URL: urls[0], Title: "Cat"}, {URL: urls[1], Title: "Cat"}},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle("", catscrapertest.Response{Content: []byte("new"), ContentType: "image/jpeg"})
+
+	writer := catscrapertest.NewFileSystem()
+	require.NoError(t, writer.MkdirAll("images", 0777))
+	require.NoError(t, writer.WriteFile("images/Cat-2.jpg", []byte("old"), 0777))
+
+	namer, err := imgfinder.NewNamer("{{.Title}}{{.Ext}}")
+	require.NoError(t, err)
+
+	finder := imgfinder.New(scrapper, writer, getter).
+		WithNamer(namer).
+		WithConflictPolicy(imgfinder.ConflictSkip).
+		WithManifest(false)
+
+	err = finder.CollectAndDownloadImages(2, 1, "images/")
+	require.NoError(t, err)
+
+	// The second image is suffixed, but Cat-2.jpg was already saved
+	assert.Equal(t, map[string][]byte{
+		"images/Cat.jpg":   []byte("new"),
+		"images/Cat-2.jpg": []byte("old"),
+		"images/Cat-3.jpg": []byte("new"),
+	}, writer.Files())
+}
+
+func TestConflictRename(t *testing.T) {
+	finder, writer, _ := newConflictFinder(t, map[string]string{
+		"images/1.png":   "old",
+		"images/1-2.jpg": "older",
+	})
+
+	err := finder.WithConflictPolicy(imgfinder.ConflictRename).CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{
+		"images/1.png":   []byte("old"),
+		"images/1-2.jpg": []byte("older"),
+		"images/1-3.jpg": []byte("new"),
+	}, writer.Files())
+}
+
+func TestConflictFail(t *testing.T) {
+	finder, _, _ := newConflictFinder(t, map[string]string{
+		"images/1.gif": "old",
+	})
+
+	err := finder.WithConflictPolicy(imgfinder.ConflictFail).CollectAndDownloadImages(1, 1, "images/")
+	require.EqualError(t, err, "downloading images: downloading image https://i.chzbgr.com/full/9730332160/h6860EF7A: images/1.gif already exists")
+}
+
+func TestContinueNumbering(t *testing.T) {
+	finder, writer, _ := newConflictFinder(t, map[string]string{
+		"images/1.jpg":       "old",
+		"images/007-cat.png": "old",
+		"images/notes.txt":   "not an image",
+		"images/99.txt":      "not an image either",
+	})
+
+	err := finder.WithContinueNumbering(true).CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte("new"), writer.Files()["images/8.jpg"])
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	policy, err := imgfinder.ParseConflictPolicy("rename")
+	require.NoError(t, err)
+	assert.Equal(t, imgfinder.ConflictRename, policy)
+
+	_, err = imgfinder.ParseConflictPolicy("ignore")
+	require.EqualError(t, err, "invalid conflict policy 'ignore', expected one of [overwrite skip rename fail]")
+}
@@ -0,0 +1,146 @@
+package imgfinder
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"strings"
+)
+
+// GIFConversionMode is how animated GIFs are converted
+type GIFConversionMode string
+
+const (
+	// GIFConvertFirstFrame converts the first frame, losing the animation
+	GIFConvertFirstFrame GIFConversionMode = "first-frame"
+	// GIFKeepAnimated saves animated GIFs as they are, without converting
+	GIFKeepAnimated GIFConversionMode = "keep"
+)
+
+func ParseGIFConversionMode(mode string) (GIFConversionMode, error) {
+	switch GIFConversionMode(mode) {
+	case GIFConvertFirstFrame, GIFKeepAnimated:
+		return GIFConversionMode(mode), nil
+	}
+
+	return "", fmt.Errorf("invalid gif conversion mode '%s', expected first-frame or keep", mode)
+}
+
+// DefaultJPEGQuality is the quality of converted JPEGs when none is set
+const DefaultJPEGQuality = 90
+
+// Conversion configures converting every saved image to a single format
+type Conversion struct {
+	// ContentType is the content type to convert to, image/jpeg or
+	// image/png. Empty means images are saved as they are downloaded.
+	ContentType string
+	// Quality of JPEGs, from 1 to 100
+	Quality int
+	// Background is what transparent pixels are flattened onto when
+	// converting to JPEG, which doesn't support transparency.
+	Background color.Color
+	GIF        GIFConversionMode
+}
+
+// ParseConversionFormat returns the content type of a format to convert to,
+// jpeg or png.
+func ParseConversionFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "jpeg", "jpg":
+		return "image/jpeg", nil
+	case "png":
+		return "image/png", nil
+	}
+
+	return "", fmt.Errorf("invalid format '%s', expected jpeg or png", format)
+}
+
+// ParseColor parses a color in hex notation, e.g. #ffffff
+func ParseColor(hexColor string) (color.Color, error) {
+	rgb, err := hex.DecodeString(strings.TrimPrefix(hexColor, "#"))
+	if err != nil || len(rgb) != 3 {
+		return nil, fmt.Errorf("invalid color '%s', expected #rrggbb", hexColor)
+	}
+
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 255}, nil
+}
+
+// formatColor formats a color in hex notation, the opposite of ParseColor
+func formatColor(c color.Color) string {
+	if c == nil {
+		return ""
+	}
+
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+// convert converts an image to the configured format, returning it with its
+// content type. Images already in the format are left as they are.
+func (c Conversion) convert(data []byte, contentType string) ([]byte, string, error) {
+	if c.ContentType == "" || c.ContentType == contentType {
+		return data, contentType, nil
+	}
+
+	var img image.Image
+	if contentType == "image/gif" {
+		animation, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("decoding: %s", err)
+		}
+
+		if len(animation.Image) > 1 && c.GIF == GIFKeepAnimated {
+			return data, contentType, nil
+		}
+
+		img = compositeFrames(animation)[0]
+	} else {
+		var err error
+		img, _, err = image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("decoding: %s", err)
+		}
+	}
+
+	var converted bytes.Buffer
+	var err error
+
+	switch c.ContentType {
+	case "image/jpeg":
+		quality := c.Quality
+		if quality == 0 {
+			quality = DefaultJPEGQuality
+		}
+
+		err = jpeg.Encode(&converted, flatten(img, c.Background), &jpeg.Options{Quality: quality})
+	case "image/png":
+		err = png.Encode(&converted, img)
+	default:
+		err = fmt.Errorf("unexpected content type '%s'", c.ContentType)
+	}
+
+	if err != nil {
+		return nil, "", fmt.Errorf("encoding: %s", err)
+	}
+
+	return converted.Bytes(), c.ContentType, nil
+}
+
+// flatten draws an image over a solid background, removing transparency
+func flatten(img image.Image, background color.Color) image.Image {
+	if background == nil {
+		background = color.White
+	}
+
+	flattened := image.NewRGBA(img.Bounds())
+	draw.Draw(flattened, flattened.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.Draw(flattened, flattened.Bounds(), img, img.Bounds().Min, draw.Over)
+
+	return flattened
+}
@@ -0,0 +1,95 @@
+package imgfinder_test
+
+import (
+	"bytes"
+	"cat-scraper/internal/imgfinder"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertsToJPEG(t *testing.T) {
+	transparent := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	var original bytes.Buffer
+	require.NoError(t, png.Encode(&original, transparent))
+
+	finder, writer := newThumbnailFinder(original.Bytes(), "image/png")
+	finder = finder.WithConversion(imgfinder.Conversion{
+		ContentType: "image/jpeg",
+		Background:  color.RGBA{R: 255, A: 255},
+	})
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	files := writer.Files()
+	assert.NotContains(t, files, "images/1.png")
+
+	converted, err := jpeg.Decode(bytes.NewReader(files["images/1.jpg"]))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 20, 10), converted.Bounds())
+
+	r, g, b, _ := converted.At(5, 5).RGBA()
+	assert.True(t, r>>8 > 240 && g>>8 < 15 && b>>8 < 15, "transparency is flattened onto the background")
+}
+
+func TestConvertsFirstFrameOfAnimatedGIF(t *testing.T) {
+	finder, writer := newThumbnailFinder(animatedGIF(t, 40, 20, 3), "image/gif")
+	finder = finder.WithConversion(imgfinder.Conversion{ContentType: "image/png", GIF: imgfinder.GIFConvertFirstFrame})
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	converted, err := png.Decode(bytes.NewReader(writer.Files()["images/1.png"]))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 40, 20), converted.Bounds())
+}
+
+func TestKeepsAnimatedGIF(t *testing.T) {
+	original := animatedGIF(t, 40, 20, 3)
+
+	finder, writer := newThumbnailFinder(original, "image/gif")
+	finder = finder.WithConversion(imgfinder.Conversion{ContentType: "image/jpeg", GIF: imgfinder.GIFKeepAnimated})
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+	assert.Equal(t, original, writer.Files()["images/1.gif"])
+
+	// Still GIFs are converted anyway
+	finder, writer = newThumbnailFinder(animatedGIF(t, 40, 20, 1), "image/gif")
+	finder = finder.WithConversion(imgfinder.Conversion{ContentType: "image/jpeg", GIF: imgfinder.GIFKeepAnimated})
+
+	err = finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+	assert.Contains(t, writer.Files(), "images/1.jpg")
+}
+
+func TestConvertInvalidImage(t *testing.T) {
+	finder, _ := newThumbnailFinder([]byte("not an image"), "image/png")
+
+	err := finder.WithConversion(imgfinder.Conversion{ContentType: "image/jpeg"}).CollectAndDownloadImages(1, 1, "images/")
+	require.EqualError(t, err, "downloading images: downloading image https://i.chzbgr.com/full/9730332160/h6860EF7A: converting: decoding: image: unknown format")
+}
+
+func TestParseConversionFormat(t *testing.T) {
+	contentType, err := imgfinder.ParseConversionFormat("JPG")
+	require.NoError(t, err)
+	assert.Equal(t, "image/jpeg", contentType)
+
+	_, err = imgfinder.ParseConversionFormat("webp")
+	require.EqualError(t, err, "invalid format 'webp', expected jpeg or png")
+}
+
+func TestParseColor(t *testing.T) {
+	parsed, err := imgfinder.ParseColor("#ff8000")
+	require.NoError(t, err)
+	assert.Equal(t, color.RGBA{R: 255, G: 128, A: 255}, parsed)
+
+	_, err = imgfinder.ParseColor("white")
+	require.EqualError(t, err, "invalid color 'white', expected #rrggbb")
+}
@@ -0,0 +1,128 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/fakesite"
+	"cat-scraper/internal/imgfinder"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fakeSiteExtensions = map[string]string{"image/jpeg": "jpg", "image/png": "png", "image/gif": "gif"}
+
+func TestDownloadsFromFakeSite(t *testing.T) {
+	server, site := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	// Memes and list covers, but no sponsored posts, ads or "Hot today"
+	// duplicates
+	expected := map[string][]byte{}
+	for _, post := range site.Posts() {
+		if post.Kind == fakesite.KindSponsored {
+			continue
+		}
+
+		content, err := fakesite.Image(post, post.Width)
+		require.NoError(t, err)
+		expected[fmt.Sprintf("images/%d.%s", len(expected)+1, fakeSiteExtensions[post.ContentType])] = content
+	}
+
+	writer := catscrapertest.NewFileSystem()
+	finder := imgfinder.New(imgfinder.CheezburgerScrapper{ImageHosts: []string{"127.0.0.1"}}, writer, http.DefaultClient).
+		WithSite(imgfinder.Site{Name: "fake", BaseURL: server.URL + "/"}).
+		WithManifest(false)
+
+	err := finder.CollectAndDownloadImages(len(expected), 3, "images")
+	require.NoError(t, err)
+	assert.Equal(t, expected, writer.Files())
+}
+
+func TestScrapsFakeSiteFirstPage(t *testing.T) {
+	server, site := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	scrapper := imgfinder.CheezburgerScrapper{ImageHosts: []string{"127.0.0.1"}}
+	images, err := scrapper.CollectImagesFrom(server.URL + "/")
+	require.NoError(t, err)
+
+	// The feed, without the sponsored post, then "Hot today"
+	var expected []imgfinder.Section
+	for _, post := range site.Posts()[:9] {
+		switch post.Kind {
+		case fakesite.KindMeme:
+			expected = append(expected, imgfinder.SectionFeed)
+		case fakesite.KindList:
+			expected = append(expected, imgfinder.SectionLists)
+		}
+	}
+	expected = append(expected, imgfinder.SectionHot, imgfinder.SectionHot, imgfinder.SectionHot)
+
+	var sections []imgfinder.Section
+	for _, image := range images {
+		sections = append(sections, image.Section)
+	}
+	assert.Equal(t, expected, sections)
+}
+
+func TestCollectsFakeSiteImagesWithoutDownloading(t *testing.T) {
+	server, site := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	writer := catscrapertest.NewFileSystem()
+	getter := catscrapertest.NewGetter()
+	finder := imgfinder.New(imgfinder.CheezburgerScrapper{ImageHosts: []string{"127.0.0.1"}}, writer, getter).
+		WithFilter(imgfinder.Filter{Sections: []imgfinder.Section{imgfinder.SectionFeed}})
+
+	images, err := finder.CollectImages([]imgfinder.SiteQuota{{Site: imgfinder.Site{Name: "fake", BaseURL: server.URL + "/"}, Amount: 8}})
+	require.NoError(t, err)
+
+	memes := site.Memes()
+	require.Len(t, images, 8)
+	for i, image := range images {
+		assert.Equal(t, memes[i].ID1, image.ID1)
+		assert.Equal(t, "fake", image.Site)
+	}
+
+	assert.Empty(t, writer.Files())
+	assert.Empty(t, getter.Requests())
+}
+
+func TestPlansFakeSiteImagesWithoutDownloading(t *testing.T) {
+	server, site := fakesite.NewServer(fakesite.Config{})
+	defer server.Close()
+
+	namer, err := imgfinder.NewNamer("{{.Site}}/{{.Index}}-{{.ID1}}{{.Ext}}")
+	require.NoError(t, err)
+
+	writer := catscrapertest.NewFileSystem()
+	getter := catscrapertest.NewGetter()
+	finder := imgfinder.New(imgfinder.CheezburgerScrapper{ImageHosts: []string{"127.0.0.1"}}, writer, getter).
+		WithFilter(imgfinder.Filter{Sections: []imgfinder.Section{imgfinder.SectionFeed}}).
+		WithNamer(namer)
+	quotas := []imgfinder.SiteQuota{{Site: imgfinder.Site{Name: "fake", BaseURL: server.URL + "/"}, Amount: 3}}
+
+	planned, err := finder.PlanImages(quotas)
+	require.NoError(t, err)
+
+	memes := site.Memes()
+	require.Len(t, planned, 3)
+	for i, image := range planned {
+		assert.Equal(t, i+1, image.Index)
+		assert.Equal(t, memes[i].ID1, image.ID1)
+		assert.Equal(t, imgfinder.SectionFeed, image.Section)
+		// The extension depends on the downloaded content type
+		assert.Equal(t, fmt.Sprintf("fake/%d-%s", i+1, memes[i].ID1), image.Path)
+	}
+
+	// Converted images have a known extension
+	planned, err = finder.WithConversion(imgfinder.Conversion{ContentType: "image/png"}).PlanImages(quotas)
+	require.NoError(t, err)
+	assert.Equal(t, "fake/1-"+memes[0].ID1+".png", planned[0].Path)
+
+	assert.Empty(t, writer.Files())
+	assert.Empty(t, getter.Requests())
+}
@@ -0,0 +1,25 @@
+package imgfinder
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// S3Signature is what S3FileSystem computes to sign a request with SigV4
+type S3Signature struct {
+	CanonicalRequest string
+	StringToSign     string
+	Signature        string
+}
+
+// SignS3Request builds a request signed like S3FileSystem does, with what was
+// computed to sign it
+func SignS3Request(fs S3FileSystem, method string, key string, query url.Values, header http.Header, body []byte, now time.Time) (*http.Request, S3Signature, error) {
+	req, signature, err := fs.newSignedRequest(method, key, query, header, body, now)
+	return req, S3Signature{
+		CanonicalRequest: signature.canonicalRequest,
+		StringToSign:     signature.stringToSign,
+		Signature:        signature.signature,
+	}, err
+}
@@ -0,0 +1,335 @@
+package imgfinder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// AspectRange is a range of aspect ratios (width / height). Zero bounds are
+// unbounded.
+type AspectRange struct {
+	Min float64
+	Max float64
+}
+
+// aspectTolerance is how much an image may differ from an exact aspect ratio,
+// since dimensions are rounded to whole pixels
+const aspectTolerance = 0.01
+
+// ParseAspectRange parses an aspect ratio range. Ratios are either W:H or a
+// number, e.g. 4:3-16:9 is from 4:3 to 16:9, 1.5- at least 1.5 and -1:1 at
+// most square. A single ratio, e.g. 16:9, only matches images in that ratio.
+func ParseAspectRange(aspect string) (AspectRange, error) {
+	invalid := fmt.Errorf("invalid aspect ratio '%s', expected W:H, MIN-MAX, MIN- or -MAX (e.g. 4:3-16:9)", aspect)
+
+	bounds := strings.Split(aspect, "-")
+	switch len(bounds) {
+	case 1:
+		ratio, err := parseAspectRatio(bounds[0])
+		if err != nil {
+			return AspectRange{}, invalid
+		}
+
+		return AspectRange{Min: ratio * (1 - aspectTolerance), Max: ratio * (1 + aspectTolerance)}, nil
+	case 2:
+		var r AspectRange
+		var err error
+
+		if bounds[0] == "" && bounds[1] == "" {
+			return AspectRange{}, invalid
+		}
+
+		if bounds[0] != "" {
+			r.Min, err = parseAspectRatio(bounds[0])
+			if err != nil {
+				return AspectRange{}, invalid
+			}
+		}
+
+		if bounds[1] != "" {
+			r.Max, err = parseAspectRatio(bounds[1])
+			if err != nil {
+				return AspectRange{}, invalid
+			}
+		}
+
+		if r.Max != 0 && r.Min > r.Max {
+			return AspectRange{}, invalid
+		}
+
+		return r, nil
+	}
+
+	return AspectRange{}, invalid
+}
+
+func parseAspectRatio(ratio string) (float64, error) {
+	parts := strings.Split(strings.TrimSpace(ratio), ":")
+	if len(parts) > 2 {
+		return 0, errors.New("too many ':'")
+	}
+
+	var numbers []float64
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n <= 0 || math.IsInf(n, 0) {
+			return 0, fmt.Errorf("invalid number '%s'", part)
+		}
+
+		numbers = append(numbers, n)
+	}
+
+	if len(numbers) == 2 {
+		return numbers[0] / numbers[1], nil
+	}
+
+	return numbers[0], nil
+}
+
+func (r AspectRange) contains(width int, height int) bool {
+	aspect := float64(width) / float64(height)
+	return (r.Min == 0 || aspect >= r.Min) && (r.Max == 0 || aspect <= r.Max)
+}
+
+func (r AspectRange) String() string {
+	switch {
+	case r.Max == 0:
+		return fmt.Sprintf("at least %.2f", r.Min)
+	case r.Min == 0:
+		return fmt.Sprintf("at most %.2f", r.Max)
+	}
+
+	return fmt.Sprintf("from %.2f to %.2f", r.Min, r.Max)
+}
+
+// A TextPattern matches the text of images, either a keyword or a regular
+// expression
+type TextPattern struct {
+	source string
+	re     *regexp.Regexp
+}
+
+// ParseTextPattern parses a pattern. Patterns between slashes, e.g. /^cats?$/,
+// are regular expressions. Anything else is a keyword, matched as whole words
+// ignoring case.
+func ParseTextPattern(pattern string) (TextPattern, error) {
+	if len(pattern) > 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return TextPattern{}, fmt.Errorf("invalid pattern '%s': %s", pattern, err)
+		}
+
+		return TextPattern{source: pattern, re: re}, nil
+	}
+
+	keyword := strings.TrimSpace(pattern)
+	if keyword == "" {
+		return TextPattern{}, fmt.Errorf("invalid pattern '%s', expected a keyword or /regexp/", pattern)
+	}
+
+	// Word boundaries only hold next to word characters, so keywords that
+	// start or end with punctuation, e.g. c++ or #caturday, are bounded only
+	// on the other side
+	expr := regexp.QuoteMeta(keyword)
+	if isWordChar(keyword[0]) {
+		expr = `\b` + expr
+	}
+	if isWordChar(keyword[len(keyword)-1]) {
+		expr += `\b`
+	}
+
+	return TextPattern{source: pattern, re: regexp.MustCompile(`(?i)` + expr)}, nil
+}
+
+// isWordChar reports whether c is a word character as \b sees it
+func isWordChar(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func (p TextPattern) String() string {
+	return p.source
+}
+
+// matches returns which field of the image the pattern matches, if any
+func (p TextPattern) matches(image Image) (string, bool) {
+	fields := []struct {
+		name string
+		text string
+	}{
+		{name: "title", text: image.Title},
+		{name: "alt", text: image.Alt},
+		// Slugs are words separated by dashes
+		{name: "slug", text: strings.ReplaceAll(image.Slug, "-", " ")},
+	}
+
+	for _, field := range fields {
+		if p.re.MatchString(field.text) {
+			return field.name, true
+		}
+	}
+
+	return "", false
+}
+
+// Filter configures which images are saved. Zero values don't filter.
+// Rejected images don't count towards the amount to download.
+type Filter struct {
+	MinWidth  int
+	MinHeight int
+	Aspect    AspectRange
+	MinBytes  int
+	MaxBytes  int
+
+	// Include makes only images whose title, alt or slug match any of the
+	// patterns be saved, and Exclude rejects the ones that match any
+	Include []TextPattern
+	Exclude []TextPattern
+
+	// Sections are the only sections of the page images are saved from.
+	// Empty means all of them.
+	Sections []Section
+}
+
+// errImageRejected is returned when an image doesn't pass the filter
+var errImageRejected = errors.New("image rejected")
+
+// rejectedError says why an image was rejected. It wraps errImageRejected.
+type rejectedError struct {
+	reason string
+}
+
+func (e rejectedError) Error() string {
+	return e.reason
+}
+
+func (e rejectedError) Unwrap() error {
+	return errImageRejected
+}
+
+func reject(format string, args ...interface{}) error {
+	return rejectedError{reason: fmt.Sprintf(format, args...)}
+}
+
+func (f Filter) filtersDimensions() bool {
+	return f.MinWidth != 0 || f.MinHeight != 0 || f.Aspect != AspectRange{}
+}
+
+// checkFound checks what the page says about an image, so images can be
+// rejected before downloading them
+func (f Filter) checkFound(image Image) error {
+	err := f.checkSection(image)
+	if err != nil {
+		return err
+	}
+
+	err = f.checkText(image)
+	if err != nil {
+		return err
+	}
+
+	return f.checkDeclared(image)
+}
+
+func (f Filter) checkSection(image Image) error {
+	if len(f.Sections) == 0 {
+		return nil
+	}
+
+	for _, section := range f.Sections {
+		if section == image.Section {
+			return nil
+		}
+	}
+
+	return reject("section '%s' is not selected", image.Section)
+}
+
+func (f Filter) checkText(image Image) error {
+	for _, pattern := range f.Exclude {
+		if field, ok := pattern.matches(image); ok {
+			return reject("%s matches excluded '%s'", field, pattern)
+		}
+	}
+
+	if len(f.Include) == 0 {
+		return nil
+	}
+
+	for _, pattern := range f.Include {
+		if _, ok := pattern.matches(image); ok {
+			return nil
+		}
+	}
+
+	return reject("title, alt and slug don't match any included pattern")
+}
+
+// checkDeclared checks the dimensions the page declares for an image. They
+// are the dimensions of the image as displayed, so the minimums are only
+// checked for images displayed at full size, while the aspect ratio is the
+// same for any size.
+func (f Filter) checkDeclared(image Image) error {
+	if image.Width <= 0 || image.Height <= 0 {
+		return nil
+	}
+
+	if image.displayedAtFullSize() {
+		err := f.checkMinDimensions(image.Width, image.Height)
+		if err != nil {
+			return err
+		}
+	}
+
+	return f.checkAspect(image.Width, image.Height)
+}
+
+// checkDownloaded checks the size of a downloaded image and its decoded
+// dimensions. Images that can't be decoded are rejected.
+func (f Filter) checkDownloaded(data []byte) error {
+	if f.MinBytes != 0 && len(data) < f.MinBytes {
+		return reject("%d bytes is less than the minimum %d", len(data), f.MinBytes)
+	}
+
+	if f.MaxBytes != 0 && len(data) > f.MaxBytes {
+		return reject("%d bytes is more than the maximum %d", len(data), f.MaxBytes)
+	}
+
+	if !f.filtersDimensions() {
+		return nil
+	}
+
+	// Images whose dimensions can't be read can't pass the checks either
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return reject("can't read the dimensions: %s", err)
+	}
+
+	err = f.checkMinDimensions(config.Width, config.Height)
+	if err != nil {
+		return err
+	}
+
+	return f.checkAspect(config.Width, config.Height)
+}
+
+func (f Filter) checkMinDimensions(width int, height int) error {
+	if width < f.MinWidth || height < f.MinHeight {
+		return reject("%dx%d is smaller than the minimum %dx%d", width, height, f.MinWidth, f.MinHeight)
+	}
+
+	return nil
+}
+
+func (f Filter) checkAspect(width int, height int) error {
+	if height == 0 || f.Aspect.contains(width, height) {
+		return nil
+	}
+
+	return reject("aspect ratio of %dx%d is not %s", width, height, f.Aspect)
+}
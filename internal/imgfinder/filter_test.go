@@ -0,0 +1,299 @@
+package imgfinder_test
+
+import (
+	"bytes"
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodedPNG(t *testing.T, width int, height int) []byte {
+	var encoded bytes.Buffer
+	require.NoError(t, png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, width, height))))
+
+	return encoded.Bytes()
+}
+
+func TestRejectsDeclaredDimensionsWithoutDownloading(t *testing.T) {
+	scrapper := MockScrapper{
+		ImagesByPage: map[string][]imgfinder.Image{
+			"https://icanhas.cheezburger.com/": {
+				{URL: "https://i.chzbgr.com/full/1/a", OriginalURL: "https://i.chzbgr.com/full/1/a/tiny", Width: 50, Height: 50},
+				{URL: "https://i.chzbgr.com/full/2/b", OriginalURL: "https://i.chzbgr.com/full/2/b/wide", Width: 400, Height: 100},
+			},
+			"https://icanhas.cheezburger.com/page/2": {
+				// Thumbnails are smaller than the image, only their aspect
+				// ratio is checked
+				{URL: "https://i.chzbgr.com/full/3/c", OriginalURL: "https://i.chzbgr.com/thumb400/3/c/ok", Width: 80, Height: 60},
+			},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle("https://i.chzbgr.com/full/3/c", catscrapertest.Response{Content: encodedPNG(t, 400, 300), ContentType: "image/png"})
+	writer := catscrapertest.NewFileSystem()
+
+	finder := imgfinder.New(scrapper, writer, getter).WithFilter(imgfinder.Filter{
+		MinWidth: 200,
+		Aspect:   imgfinder.AspectRange{Min: 1, Max: 2},
+	})
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"https://i.chzbgr.com/full/3/c"}, getter.Requests())
+	assert.Contains(t, writer.Files(), "images/1.png")
+}
+
+func TestReplacesImagesRejectedAfterDownloading(t *testing.T) {
+	scrapper := MockScrapper{
+		URLsByPage: map[string][]string{
+			"https://icanhas.cheezburger.com/":       {"https://i.chzbgr.com/full/1/a", "https://i.chzbgr.com/full/2/b"},
+			"https://icanhas.cheezburger.com/page/2": {"https://i.chzbgr.com/full/3/c", "https://i.chzbgr.com/full/4/d"},
+		},
+	}
+
+	small := encodedPNG(t, 10, 10)
+	big := encodedPNG(t, 300, 200)
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle("https://i.chzbgr.com/full/1/a", catscrapertest.Response{Content: small, ContentType: "image/png"})
+	getter.Handle("https://i.chzbgr.com/full/2/b", catscrapertest.Response{Content: big, ContentType: "image/png"})
+	getter.Handle("https://i.chzbgr.com/full/3/c", catscrapertest.Response{Content: small, ContentType: "image/png"})
+	getter.Handle("https://i.chzbgr.com/full/4/d", catscrapertest.Response{Content: big, ContentType: "image/png"})
+	writer := catscrapertest.NewFileSystem()
+
+	finder := imgfinder.New(scrapper, writer, getter).WithFilter(imgfinder.Filter{MinWidth: 100, MinHeight: 100})
+
+	err := finder.CollectAndDownloadImages(2, 2, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{
+		"images/1.png": big,
+		"images/2.png": big,
+	}, writer.Files())
+	assert.Len(t, getter.Requests(), 4)
+}
+
+func TestFiltersFileSize(t *testing.T) {
+	scrapper := MockScrapper{
+		URLsByPage: map[string][]string{
+			"https://icanhas.cheezburger.com/": {
+				"https://i.chzbgr.com/full/1/a",
+				"https://i.chzbgr.com/full/2/b",
+				"https://i.chzbgr.com/full/3/c",
+			},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle("https://i.chzbgr.com/full/1/a", catscrapertest.Response{Content: []byte("tiny"), ContentType: "image/jpeg"})
+	getter.Handle("https://i.chzbgr.com/full/2/b", catscrapertest.Response{Content: []byte("way too big"), ContentType: "image/jpeg"})
+	getter.Handle("https://i.chzbgr.com/full/3/c", catscrapertest.Response{Content: []byte("just ok"), ContentType: "image/jpeg"})
+	writer := catscrapertest.NewFileSystem()
+
+	finder := imgfinder.New(scrapper, writer, getter).WithFilter(imgfinder.Filter{MinBytes: 5, MaxBytes: 10})
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{"images/1.jpg": []byte("just ok")}, writer.Files())
+}
+
+func TestFilterInvalidImage(t *testing.T) {
+	const url = "https://i.chzbgr.com/full/1/a"
+	scrapper := MockScrapper{
+		URLsByPage: map[string][]string{
+			"https://icanhas.cheezburger.com/":       {url},
+			"https://icanhas.cheezburger.com/page/2": {},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle(url, catscrapertest.Response{Content: []byte("not an image"), ContentType: "image/png"})
+	writer := catscrapertest.NewFileSystem()
+
+	var events []imgfinder.Event
+	err := imgfinder.New(scrapper, writer, getter).
+		WithFilter(imgfinder.Filter{MinWidth: 10}).
+		WithObserver(recordingObserver{events: &events}).
+		CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Empty(t, writer.Files())
+	require.Len(t, events, 1)
+	assert.Equal(t, imgfinder.EventSkipped, events[0].Kind)
+	assert.EqualError(t, events[0].Err, "can't read the dimensions: image: unknown format")
+}
+
+func TestParseAspectRange(t *testing.T) {
+	tests := []struct {
+		aspect   string
+		expected imgfinder.AspectRange
+	}{
+		{aspect: "4:3-16:9", expected: imgfinder.AspectRange{Min: 4.0 / 3, Max: 16.0 / 9}},
+		{aspect: "1.5-", expected: imgfinder.AspectRange{Min: 1.5}},
+		{aspect: "-1:1", expected: imgfinder.AspectRange{Max: 1}},
+		{aspect: "2:1", expected: imgfinder.AspectRange{Min: 2 * 0.99, Max: 2 * 1.01}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.aspect, func(t *testing.T) {
+			aspect, err := imgfinder.ParseAspectRange(test.aspect)
+			require.NoError(t, err)
+			assert.InDelta(t, test.expected.Min, aspect.Min, 0.0001)
+			assert.InDelta(t, test.expected.Max, aspect.Max, 0.0001)
+		})
+	}
+
+	for _, invalid := range []string{"", "-", "wide", "16:9:1", "2-1", "0:1"} {
+		_, err := imgfinder.ParseAspectRange(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestFiltersByText(t *testing.T) {
+	scrapper := MockScrapper{
+		ImagesByPage: map[string][]imgfinder.Image{
+			"https://icanhas.cheezburger.com/": {
+				{URL: "https://i.chzbgr.com/full/1/a", Title: "Dogs being dogs"},
+				{URL: "https://i.chzbgr.com/full/2/b", Alt: "collection of black cat appreciation posts", Title: "Ad"},
+				{URL: "https://i.chzbgr.com/full/3/c", Title: "Nothing to see"},
+			},
+			"https://icanhas.cheezburger.com/page/2": {
+				{URL: "https://i.chzbgr.com/full/4/d", Slug: "a-cat-and-a-dog"},
+				{URL: "https://i.chzbgr.com/full/5/e", Slug: "cats-in-boxes"},
+			},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle("", catscrapertest.Response{Content: []byte("meme"), ContentType: "image/jpeg"})
+	writer := catscrapertest.NewFileSystem()
+
+	include, err := imgfinder.ParseTextPattern("/(?i)cats?/")
+	require.NoError(t, err)
+	exclude, err := imgfinder.ParseTextPattern("dog")
+	require.NoError(t, err)
+	excludeAds, err := imgfinder.ParseTextPattern("ad")
+	require.NoError(t, err)
+
+	finder := imgfinder.New(scrapper, writer, getter).WithFilter(imgfinder.Filter{
+		Include: []imgfinder.TextPattern{include},
+		Exclude: []imgfinder.TextPattern{exclude, excludeAds},
+	})
+
+	err = finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"https://i.chzbgr.com/full/5/e"}, getter.Requests())
+}
+
+func TestParseTextPattern(t *testing.T) {
+	_, err := imgfinder.ParseTextPattern("/(/")
+	require.EqualError(t, err, "invalid pattern '/(/': error parsing regexp: missing closing ): `(`")
+
+	_, err = imgfinder.ParseTextPattern(" ")
+	require.EqualError(t, err, "invalid pattern ' ', expected a keyword or /regexp/")
+
+	keyword, err := imgfinder.ParseTextPattern("Cat")
+	require.NoError(t, err)
+	assert.Equal(t, "Cat", keyword.String())
+}
+
+func TestKeywordsWithPunctuation(t *testing.T) {
+	for keyword, titles := range map[string][2]string{
+		"c++":       {"Cats learning c++", "Cats learning abc++"},
+		"#caturday": {"Happy #caturday!", "Happy #caturdays"},
+		"wtf?":      {"wtf? said the cat", "swtf? said the cat"},
+	} {
+		t.Run(keyword, func(t *testing.T) {
+			scrapper := MockScrapper{
+				ImagesByPage: map[string][]imgfinder.Image{
+					"https://icanhas.cheezburger.com/": {
+						{URL: "https://i.chzbgr.com/full/1/a", Title: titles[0]},
+						{URL: "https://i.chzbgr.com/full/2/b", Title: titles[1]},
+					},
+				},
+			}
+
+			getter := catscrapertest.NewGetter()
+			getter.Handle("", catscrapertest.Response{Content: []byte("meme"), ContentType: "image/jpeg"})
+			writer := catscrapertest.NewFileSystem()
+
+			pattern, err := imgfinder.ParseTextPattern(keyword)
+			require.NoError(t, err)
+			finder := imgfinder.New(scrapper, writer, getter).WithFilter(imgfinder.Filter{Include: []imgfinder.TextPattern{pattern}})
+
+			err = finder.CollectAndDownloadImages(1, 1, "images/")
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{"https://i.chzbgr.com/full/1/a"}, getter.Requests())
+		})
+	}
+}
+
+// pageScrapper returns the images of every page from a function
+type pageScrapper func(page string) ([]imgfinder.Image, error)
+
+func (s pageScrapper) CollectImagesFrom(page string) ([]imgfinder.Image, error) {
+	return s(page)
+}
+
+func TestStopsPagingWhenTheFilterRejectsEverything(t *testing.T) {
+	var pages []string
+	scrapper := pageScrapper(func(page string) ([]imgfinder.Image, error) {
+		pages = append(pages, page)
+		return []imgfinder.Image{{URL: "https://i.chzbgr.com/full/1/a", Title: "Grumpy cat"}}, nil
+	})
+
+	getter := catscrapertest.NewGetter()
+	writer := catscrapertest.NewFileSystem()
+
+	dogs, err := imgfinder.ParseTextPattern("dog")
+	require.NoError(t, err)
+	finder := imgfinder.New(scrapper, writer, getter).WithFilter(imgfinder.Filter{Include: []imgfinder.TextPattern{dogs}})
+
+	err = finder.CollectAndDownloadImages(3, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Len(t, pages, 5)
+	assert.Empty(t, getter.Requests())
+	assert.Empty(t, writer.Files())
+}
+
+func TestStopsPagingWhenTheSiteRunsOut(t *testing.T) {
+	for name, lastPage := range map[string]func() ([]imgfinder.Image, error){
+		"not found":  func() ([]imgfinder.Image, error) { return nil, imgfinder.ErrPageNotFound },
+		"empty page": func() ([]imgfinder.Image, error) { return nil, nil },
+	} {
+		t.Run(name, func(t *testing.T) {
+			var pages []string
+			scrapper := pageScrapper(func(page string) ([]imgfinder.Image, error) {
+				pages = append(pages, page)
+				if len(pages) == 1 {
+					return []imgfinder.Image{{URL: "https://i.chzbgr.com/full/1/a"}}, nil
+				}
+
+				return lastPage()
+			})
+
+			getter := catscrapertest.NewGetter()
+			getter.Handle("", catscrapertest.Response{Content: []byte("meme"), ContentType: "image/jpeg"})
+			writer := catscrapertest.NewFileSystem()
+
+			finder := imgfinder.New(scrapper, writer, getter).WithManifest(false)
+
+			err := finder.CollectAndDownloadImages(3, 1, "images/")
+			require.NoError(t, err)
+
+			assert.Len(t, pages, 2)
+			assert.Equal(t, map[string][]byte{"images/1.jpg": []byte("meme")}, writer.Files())
+		})
+	}
+}
@@ -1,13 +1,61 @@
 package imgfinder
 
-import "os"
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
 
 type RealFileSystem struct{}
 
+// WriteFile writes to a partial file first, so interrupted writes never leave
+// a truncated file with the final name
 func (fs RealFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
-	return os.WriteFile(name, data, perm)
+	partial := name + PartialSuffix
+
+	err := os.WriteFile(partial, data, perm)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(partial, name)
 }
 
 func (fs RealFileSystem) MkdirAll(name string, perm os.FileMode) error {
 	return os.MkdirAll(name, perm)
 }
+
+func (fs RealFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (fs RealFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (fs RealFileSystem) Exists(name string) (bool, error) {
+	return existsFromStat(fs, name)
+}
+
+func (fs RealFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (fs RealFileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+// existsFromStat implements Exists for file systems that report missing files
+// with errors wrapping fs.ErrNotExist
+func existsFromStat(fileSystem FileSystem, name string) (bool, error) {
+	_, err := fileSystem.Stat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -1,18 +1,71 @@
 package imgfinder
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
+	"strings"
+	"time"
 )
 
 // A Scrapper knows how to obtain different things from webpages by GETting
 // their content and parsing their HTML.
 type Scrapper interface {
-	CollectImageURLsFrom(page string) ([]string, error)
+	CollectImagesFrom(page string) ([]Image, error)
+}
+
+// ErrPageNotFound is returned by scrappers for pages that don't exist, like
+// the ones after the last page of a site
+var ErrPageNotFound = errors.New("page not found")
+
+// maxPagesWithoutNewImages is how many pages in a row without new images that
+// pass the filter are scrapped before giving up on a site
+const maxPagesWithoutNewImages = 5
+
+// An Image is a meme found by a Scrapper
+type Image struct {
+	// URL is the full size version of the image without the slug, which
+	// identifies it.
+	URL string
+	// OriginalURL is the URL of the image as found in the page
+	OriginalURL string
+
+	// Cheezburger image URLs have the format {size}/{id1}/{id2}/{slug}
+	ID1  string
+	ID2  string
+	Slug string
+
+	Title string
+	Alt   string
+	// Site is the name of the Cheezburger site the image was found on
+	Site string
+	// Section is the section of the page the image was found in
+	Section Section
+
+	// Width and Height are declared by the page for the image as it's
+	// displayed, 0 if they aren't
+	Width  int
+	Height int
+}
+
+// Key identifies the image regardless of its size, as {id1}/{id2}. Images
+// without ids are identified by their URL.
+func (i Image) Key() string {
+	if i.ID1 == "" || i.ID2 == "" {
+		return i.URL
+	}
+
+	return i.ID1 + "/" + i.ID2
+}
+
+// displayedAtFullSize is whether the image is displayed in the page in full
+// size rather than as a thumbnail
+func (i Image) displayedAtFullSize() bool {
+	parts, err := imageURLPathParts(i.OriginalURL)
+	return err == nil && parts[0] == string(SizeFull)
 }
 
 // An HTTPGetter knows how to perform HTTP GET requests
@@ -20,35 +73,193 @@ type HTTPGetter interface {
 	Get(url string) (resp *http.Response, err error)
 }
 
-// A FileSystem provides access to the file system
+// A FileSystem provides access to the file system. Missing files are reported
+// with errors wrapping fs.ErrNotExist.
 type FileSystem interface {
 	WriteFile(name string, data []byte, perm os.FileMode) error
 	MkdirAll(name string, perm os.FileMode) error
+	ReadFile(name string) ([]byte, error)
+	Stat(name string) (os.FileInfo, error)
+	Exists(name string) (bool, error)
+	Remove(name string) error
+	ReadDir(name string) ([]os.DirEntry, error)
 }
 
 type Finder struct {
 	scrapper   Scrapper
 	fileSystem FileSystem
 	getter     HTTPGetter
+	namer      Namer
+	size       Size
+
+	conflictPolicy    ConflictPolicy
+	continueNumbering bool
+
+	thumbnails    Thumbnails
+	conversion    Conversion
+	manifest      bool
+	provenance    bool
+	stripMetadata bool
+	filter        Filter
+	verbose       bool
+	site          Site
+	log           io.Writer
+	observer      Observer
+	keepGoing     bool
 }
 
 func New(scrapper Scrapper, fileSystem FileSystem, getter HTTPGetter) Finder {
+	// The default template is known to be valid
+	namer, _ := NewNamer(DefaultNameTemplate)
+
 	return Finder{
 		scrapper:   scrapper,
 		fileSystem: fileSystem,
 		getter:     getter,
+		namer:      namer,
+		size:       SizeLargestAvailable,
+		site:       DefaultSite,
+		log:        os.Stdout,
+
+		conflictPolicy: ConflictOverwrite,
 	}
 }
 
+// WithScrapper returns a copy of the finder that finds images with scrapper
+func (f Finder) WithScrapper(scrapper Scrapper) Finder {
+	f.scrapper = scrapper
+	return f
+}
+
+// WithGetter returns a copy of the finder that downloads images with getter
+func (f Finder) WithGetter(getter HTTPGetter) Finder {
+	f.getter = getter
+	return f
+}
+
+// WithFileSystem returns a copy of the finder that saves images to fileSystem
+func (f Finder) WithFileSystem(fileSystem FileSystem) Finder {
+	f.fileSystem = fileSystem
+	return f
+}
+
+// WithNamer returns a copy of the finder that names saved images with namer
+func (f Finder) WithNamer(namer Namer) Finder {
+	f.namer = namer
+	return f
+}
+
+// WithSize returns a copy of the finder that downloads images in size
+func (f Finder) WithSize(size Size) Finder {
+	f.size = size
+	return f
+}
+
+// WithConflictPolicy returns a copy of the finder that handles images that
+// already exist with policy
+func (f Finder) WithConflictPolicy(policy ConflictPolicy) Finder {
+	f.conflictPolicy = policy
+	return f
+}
+
+// WithContinueNumbering returns a copy of the finder that, if enabled,
+// numbers images starting after the highest number of the existing ones, so
+// runs don't overwrite each other.
+func (f Finder) WithContinueNumbering(enabled bool) Finder {
+	f.continueNumbering = enabled
+	return f
+}
+
+// WithThumbnails returns a copy of the finder that saves resized variants of
+// every image alongside it
+func (f Finder) WithThumbnails(thumbnails Thumbnails) Finder {
+	f.thumbnails = thumbnails
+	return f
+}
+
+// WithConversion returns a copy of the finder that converts every image before
+// saving it
+func (f Finder) WithConversion(conversion Conversion) Finder {
+	f.conversion = conversion
+	return f
+}
+
+// WithManifest returns a copy of the finder that, if enabled, records the
+// saved images in the manifest of the images directory
+func (f Finder) WithManifest(enabled bool) Finder {
+	f.manifest = enabled
+	return f
+}
+
+// WithProvenance returns a copy of the finder that, if enabled, embeds the
+// provenance of every image in the saved file
+func (f Finder) WithProvenance(enabled bool) Finder {
+	f.provenance = enabled
+	return f
+}
+
+// WithStripMetadata returns a copy of the finder that, if enabled, removes
+// privacy sensitive metadata from every image before saving it
+func (f Finder) WithStripMetadata(enabled bool) Finder {
+	f.stripMetadata = enabled
+	return f
+}
+
+// WithFilter returns a copy of the finder that only saves images that pass
+// filter
+func (f Finder) WithFilter(filter Filter) Finder {
+	f.filter = filter
+	return f
+}
+
+// WithVerbose returns a copy of the finder that, if enabled, explains why
+// every rejected image was skipped
+func (f Finder) WithVerbose(enabled bool) Finder {
+	f.verbose = enabled
+	return f
+}
+
+// WithSite returns a copy of the finder that takes images from site
+func (f Finder) WithSite(site Site) Finder {
+	f.site = site
+	return f
+}
+
+// WithLog returns a copy of the finder that reports its progress to log
+func (f Finder) WithLog(log io.Writer) Finder {
+	f.log = log
+	return f
+}
+
+// WithObserver returns a copy of the finder that tells observer what happens
+// to every image it downloads
+func (f Finder) WithObserver(observer Observer) Finder {
+	f.observer = observer
+	return f
+}
+
+// WithKeepGoing returns a copy of the finder that, if enabled, skips images
+// that can't be downloaded or saved instead of stopping. They aren't replaced.
+func (f Finder) WithKeepGoing(enabled bool) Finder {
+	f.keepGoing = enabled
+	return f
+}
+
 func (f Finder) CollectAndDownloadImages(amount int, threads int, imagesDirectory string) error {
-	imageURLs, err := f.collectImageURLs(amount)
+	return f.CollectAndDownloadFromSites([]SiteQuota{{Site: f.site, Amount: amount}}, threads, imagesDirectory)
+}
+
+// CollectAndDownloadFromSites downloads the amount of images of every quota
+// from its site. Images found in more than one site are only downloaded once.
+func (f Finder) CollectAndDownloadFromSites(quotas []SiteQuota, threads int, imagesDirectory string) error {
+	images, err := f.collectFromSites(quotas)
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Downloading images")
+	fmt.Fprintln(f.log, "Downloading images")
 
-	err = f.downloadImages(imageURLs[0:amount], imagesDirectory, threads)
+	err = f.downloadImages(images, imagesDirectory, threads)
 	if err != nil {
 		return fmt.Errorf("downloading images: %s", err)
 	}
@@ -56,133 +267,539 @@ func (f Finder) CollectAndDownloadImages(amount int, threads int, imagesDirector
 	return nil
 }
 
-func (f Finder) collectImageURLs(amount int) ([]string, error) {
-	// Images are duplicated because they appear in the "Hot today" section and
-	// on the homepage. Because we don't want to download them twice, we remove
-	// the duplicates. We know the URLs will be the same because we converted
-	// all of them to full size
+// DownloadImages downloads images that were already found, like the ones of
+// an image list. Images rejected after downloading them aren't replaced.
+func (f Finder) DownloadImages(images []Image, threads int, imagesDirectory string) error {
+	// The collector has no more images to replace rejected ones with
+	collector := &imageCollector{exhausted: true}
+
+	var collected []collectedImage
+	for _, image := range images {
+		collected = append(collected, collectedImage{image: image, collector: collector})
+	}
+
+	fmt.Fprintln(f.log, "Downloading images")
+
+	err := f.downloadImages(collected, imagesDirectory, threads)
+	if err != nil {
+		return fmt.Errorf("downloading images: %s", err)
+	}
+
+	return nil
+}
+
+// CollectImages returns the amount of images of every quota from its site,
+// without downloading them. Images are filtered only with what the pages say
+// about them.
+func (f Finder) CollectImages(quotas []SiteQuota) ([]Image, error) {
+	collected, err := f.collectFromSites(quotas)
+	if err != nil {
+		return nil, err
+	}
+
+	var images []Image
+	for _, image := range collected {
+		images = append(images, image.image)
+	}
+
+	return images, nil
+}
+
+// collectFromSites collects the images of every quota, leaving out the ones
+// found in more than one site
+func (f Finder) collectFromSites(quotas []SiteQuota) ([]collectedImage, error) {
+	seen := map[string]bool{}
 
-	seenImageURLs := map[string]bool{}
-	var imageURLs []string
+	var images []collectedImage
+	for _, quota := range quotas {
+		collector := f.newImageCollector(quota.Site, seen)
 
-	currentPage := 1
-	for len(imageURLs) < amount {
-		urls, err := f.scrapper.CollectImageURLsFrom(cheezburgerURLForPage(currentPage))
+		found, err := collector.collectImageURLs(quota.Amount)
 		if err != nil {
-			return nil, fmt.Errorf("collecting image urls: %s", err)
+			return nil, err
 		}
 
-		duplicates := 0
-		for _, url := range urls {
-			if _, seen := seenImageURLs[url]; !seen {
-				seenImageURLs[url] = true
-				imageURLs = append(imageURLs, url)
-			} else {
-				duplicates++
-			}
+		for _, image := range found {
+			images = append(images, collectedImage{image: image, collector: collector})
 		}
+	}
 
-		fmt.Printf("Found %d images (%d duplicates, %d new)\n", len(urls), duplicates, len(urls)-duplicates)
+	return images, nil
+}
 
-		currentPage++
+// imageCollector collects images from the pages of a site lazily, paging as
+// more images are needed. Images are only collected once, and images that
+// don't pass the filter with what the page says about them are left out.
+type imageCollector struct {
+	scrapper Scrapper
+	site     Site
+	filter   Filter
+	verbose  bool
+	log      io.Writer
+	observer Observer
+
+	// seen may be shared by the collectors of many sites
+	seen        map[string]bool
+	pending     []Image
+	currentPage int
+	// exhausted is set when no more pages have images that pass the filter:
+	// the site ran out of pages, or many pages in a row had no new images
+	exhausted bool
+	// pagesWithoutNewImages are the last pages in a row without new images
+	pagesWithoutNewImages int
+}
+
+func (f Finder) newImageCollector(site Site, seen map[string]bool) *imageCollector {
+	return &imageCollector{
+		scrapper:    f.scrapper,
+		site:        site,
+		filter:      f.filter,
+		verbose:     f.verbose,
+		log:         f.log,
+		observer:    f.observer,
+		seen:        seen,
+		currentPage: 1,
 	}
+}
 
-	return imageURLs, nil
+// collectedImage is an image along with the collector it came from, which
+// collects its replacement if it's rejected
+type collectedImage struct {
+	image     Image
+	collector *imageCollector
 }
 
-func cheezburgerURLForPage(pageNumber int) string {
-	if pageNumber == 1 {
-		return "https://icanhas.cheezburger.com/"
+// collectImageURLs returns the next amount images, going to the next pages
+// when necessary. It returns less images if the site runs out of them.
+func (c *imageCollector) collectImageURLs(amount int) ([]Image, error) {
+	for len(c.pending) < amount && !c.exhausted {
+		err := c.collectNextPage()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return fmt.Sprintf("https://icanhas.cheezburger.com/page/%d", pageNumber)
+	if amount > len(c.pending) {
+		amount = len(c.pending)
+	}
+
+	images := c.pending[:amount]
+	c.pending = c.pending[amount:]
+
+	return images, nil
+}
+
+func (c *imageCollector) collectNextPage() error {
+	// Images are duplicated because they appear in the "Hot today" section and
+	// on the homepage. Because we don't want to download them twice, we remove
+	// the duplicates. The key is the same regardless of the size in the URL.
+
+	found, err := c.scrapper.CollectImagesFrom(c.site.urlForPage(c.currentPage))
+	if errors.Is(err, ErrPageNotFound) {
+		fmt.Fprintf(c.log, "Page %d of %s not found, not going to the next pages\n", c.currentPage, c.site.Name)
+		c.exhausted = true
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("collecting image urls: %s", err)
+	}
+
+	if len(found) == 0 {
+		fmt.Fprintf(c.log, "Page %d of %s has no images, not going to the next pages\n", c.currentPage, c.site.Name)
+		c.exhausted = true
+		return nil
+	}
+
+	duplicates := 0
+	rejected := 0
+	for _, image := range found {
+		if c.seen[image.Key()] {
+			duplicates++
+			continue
+		}
+
+		// Rejected images aren't marked as seen, as other copies of them may
+		// pass the filter, e.g. when they are in another section
+		err := c.filter.checkFound(image)
+		if err != nil {
+			if c.verbose {
+				fmt.Fprintf(c.log, "Skipping %s, %s\n", image.URL, err)
+			}
+			if c.observer != nil {
+				c.observer.Observe(Event{Kind: EventSkipped, Image: image, Err: err})
+			}
+			rejected++
+			continue
+		}
+		c.seen[image.Key()] = true
+
+		image.Site = c.site.Name
+		c.pending = append(c.pending, image)
+	}
+
+	added := len(found) - duplicates - rejected
+	fmt.Fprintf(c.log, "Found %d images (%d duplicates, %d rejected, %d new)\n", len(found), duplicates, rejected, added)
+
+	c.pagesWithoutNewImages++
+	if added > 0 {
+		c.pagesWithoutNewImages = 0
+	}
+
+	if c.pagesWithoutNewImages == maxPagesWithoutNewImages {
+		fmt.Fprintf(c.log, "No new images in the last %d pages of %s, not going to the next pages\n", maxPagesWithoutNewImages, c.site.Name)
+		c.exhausted = true
+	}
+
+	c.currentPage++
+	return nil
 }
 
 type imageRequest struct {
-	url  string
-	path string
+	collectedImage
+	index int
 }
 
-func (f Finder) downloadImages(urls []string, basePath string, threads int) error {
-	err := f.fileSystem.MkdirAll(basePath, 0777)
+// imageResult is the result of downloading a requested image
+type imageResult struct {
+	request imageRequest
+	// entry is the manifest entry of the saved image
+	entry ManifestEntry
+	err   error
+}
+
+// downloadImages downloads images, numbering them in order. Images rejected
+// after downloading them are replaced by the next ones of their collector,
+// with the same index, so as many images as requested are saved.
+func (f Finder) downloadImages(images []collectedImage, basePath string, threads int) (err error) {
+	err = f.fileSystem.MkdirAll(basePath, 0777)
 	if err != nil {
 		return fmt.Errorf("creating destination directory %s: %s", basePath, err)
 	}
 
-	// Make a buffered channel so we can schedule all the jobs without blocking
-	numJobs := len(urls)
+	// Make buffered channels so we can schedule all the jobs without blocking.
+	// There are never more jobs in flight than images.
+	numJobs := len(images)
 	imagesToDownload := make(chan imageRequest, numJobs)
-	results := make(chan error, numJobs)
+	results := make(chan imageResult, numJobs)
+	defer close(imagesToDownload)
+
+	saver := imageSaver{
+		basePath:     basePath,
+		date:         time.Now().Format("2006-01-02"),
+		reservations: newPathReservations(),
+		manifest:     newManifestChanges(),
+	}
+
+	// The manifest is updated however the run ends, so the images saved
+	// before a failure are recorded
+	if f.manifest {
+		defer func() {
+			manifestErr := f.updateManifest(basePath, saver.manifest)
+			switch {
+			case err == nil:
+				err = manifestErr
+			case manifestErr != nil:
+				err = fmt.Errorf("%s, and updating the manifest: %s", err, manifestErr)
+			}
+		}()
+	}
+
+	firstIndex := 1
+	if f.continueNumbering {
+		highest, err := f.highestIndex(basePath)
+		if err != nil {
+			return err
+		}
+
+		firstIndex = highest + 1
+	}
 
 	for w := 0; w < threads; w++ {
-		go f.imageDownloadWorker(imagesToDownload, results)
+		go f.imageDownloadWorker(imagesToDownload, results, saver)
 	}
 
-	for i, url := range urls {
-		// i+1 to number from 1 and not 0
-		path := filepath.Join(basePath, strconv.Itoa(i+1))
-		imagesToDownload <- imageRequest{url: url, path: path}
+	for i, image := range images {
+		imagesToDownload <- imageRequest{collectedImage: image, index: firstIndex + i}
 	}
 
 	// Grab all results, check no download failed
-	for r := 0; r < numJobs; r++ {
-		err := <-results
-		if err != nil {
-			return err
+	for done := 0; done < numJobs; {
+		result := <-results
+		image := result.request.image
+
+		switch {
+		case errors.Is(result.err, errImageRejected):
+			f.observe(Event{Kind: EventSkipped, Image: image, Err: result.err})
+
+			collector := result.request.collector
+			replacement, err := collector.collectImageURLs(1)
+			if err != nil {
+				return err
+			}
+
+			// The site ran out of images, so this one isn't replaced
+			if len(replacement) == 0 {
+				done++
+				continue
+			}
+
+			imagesToDownload <- imageRequest{
+				collectedImage: collectedImage{image: replacement[0], collector: collector},
+				index:          result.request.index,
+			}
+			continue
+		case errors.Is(result.err, errImageExists):
+			f.observe(Event{Kind: EventSkipped, Image: image, Err: result.err})
+		case result.err != nil:
+			f.observe(Event{Kind: EventFailed, Image: image, Err: result.err})
+			if !f.keepGoing {
+				return result.err
+			}
+
+			fmt.Fprintf(f.log, "Failed %s\n", result.err)
+		default:
+			f.observe(Event{
+				Kind:            EventSaved,
+				Image:           image,
+				Path:            result.entry.Path,
+				Size:            result.entry.Size,
+				LocationRemoved: result.entry.LocationRemoved,
+			})
 		}
+
+		done++
 	}
 
 	return nil
 }
 
-func (f Finder) imageDownloadWorker(imagesToDownload chan imageRequest, results chan error) {
-	for image := range imagesToDownload {
-		err := f.downloadImage(image.url, image.path)
-		var result error
-		if err != nil {
-			result = fmt.Errorf("downloading image %s: %s", image.url, err)
+// imageSaver has what's shared by all downloads of a run to decide where to
+// save images
+type imageSaver struct {
+	basePath     string
+	date         string
+	reservations *pathReservations
+	manifest     *manifestChanges
+}
+
+func (f Finder) imageDownloadWorker(imagesToDownload chan imageRequest, results chan imageResult, saver imageSaver) {
+	for request := range imagesToDownload {
+		entry, err := f.downloadImage(request, saver)
+		if errors.Is(err, errImageRejected) {
+			if f.verbose {
+				fmt.Fprintf(f.log, "Skipping %s, %s\n", request.image.URL, err)
+			}
+		} else if err != nil && !errors.Is(err, errImageExists) {
+			err = fmt.Errorf("downloading image %s: %s", request.image.URL, err)
 		}
 
-		results <- result
+		results <- imageResult{request: request, entry: entry, err: err}
 	}
 }
 
-func (f Finder) downloadImage(url string, filename string) error {
-	resp, err := f.getter.Get(url)
+// downloadImage downloads and saves an image, returning its manifest entry
+func (f Finder) downloadImage(request imageRequest, saver imageSaver) (ManifestEntry, error) {
+	// Check conflicts before downloading so skipped images aren't downloaded
+	// for nothing. The extension isn't known yet, so any is a conflict.
+	stem, err := f.imageStem(request, saver)
 	if err != nil {
-		return fmt.Errorf("get: %s", err)
+		return ManifestEntry{}, err
+	}
+
+	err = f.checkConflicts(stem, saver)
+	if errors.Is(err, errImageExists) {
+		fmt.Fprintf(f.log, "Skipping %s, %s already exists\n", request.image.URL, stem)
+		return ManifestEntry{}, err
+	}
+
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	resp, url, err := f.getImage(request.image)
+	if err != nil {
+		return ManifestEntry{}, err
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code '%d' expected 200 OK", resp.StatusCode)
+		return ManifestEntry{}, fmt.Errorf("unexpected status code '%d' expected 200 OK", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("reading body: %s", err)
+		return ManifestEntry{}, fmt.Errorf("reading body: %s", err)
 	}
 
-	ext, err := detectFileExtension(resp.Header.Get("Content-Type"))
+	originalType := resp.Header.Get("Content-Type")
+	_, err = detectFileExtension(originalType)
 	if err != nil {
-		return err
+		return ManifestEntry{}, err
+	}
+
+	err = f.filter.checkDownloaded(body)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	body, contentType, err := f.conversion.convert(body, originalType)
+	if err != nil {
+		return ManifestEntry{}, fmt.Errorf("converting: %s", err)
+	}
+
+	// Metadata is stripped before the provenance is embedded, so it's kept
+	hadLocation := false
+	if f.stripMetadata {
+		body, hadLocation, err = stripMetadata(body, contentType)
+		if err != nil {
+			return ManifestEntry{}, fmt.Errorf("stripping metadata: %s", err)
+		}
+	}
+
+	downloadedAt := time.Now().UTC()
+	if f.provenance {
+		body, err = embedProvenance(body, contentType, Provenance{
+			SourceURL:    url,
+			Title:        request.image.Title,
+			Site:         request.image.Site,
+			DownloadedAt: downloadedAt,
+		})
+		if err != nil {
+			return ManifestEntry{}, fmt.Errorf("embedding provenance: %s", err)
+		}
+	}
+
+	ext, err := detectFileExtension(contentType)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	path, err := f.imagePath(request, ext, saver)
+	if err != nil {
+		return ManifestEntry{}, err
 	}
 
 	// Permissions don't matter much here
-	err = f.fileSystem.WriteFile(filename+ext, body, 0777)
+	err = f.fileSystem.WriteFile(path, body, 0777)
 	if err != nil {
-		return fmt.Errorf("saving: %s", err)
+		return ManifestEntry{}, fmt.Errorf("saving: %s", err)
 	}
 
-	return nil
+	if hadLocation {
+		fmt.Fprintf(f.log, "Removed location data from %s\n", path)
+	}
+
+	thumbnails, err := f.saveThumbnails(path, body)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	err = f.removeStaleVariants(path, saver)
+	if err != nil {
+		return ManifestEntry{}, err
+	}
+
+	entry := ManifestEntry{
+		Path:            manifestPath(saver.basePath, path),
+		URL:             url,
+		Title:           request.image.Title,
+		Site:            request.image.Site,
+		Section:         request.image.Section,
+		OriginalType:    originalType,
+		SavedType:       contentType,
+		Size:            len(body),
+		SHA256:          sha256Hex(body),
+		DownloadedAt:    downloadedAt,
+		LocationRemoved: hadLocation,
+		Settings:        f.saveSettings(),
+	}
+
+	for _, thumbnail := range thumbnails {
+		entry.Thumbnails = append(entry.Thumbnails, manifestPath(saver.basePath, thumbnail))
+	}
+
+	saver.manifest.save(entry)
+	return entry, nil
 }
 
-func detectFileExtension(contentType string) (string, error) {
-	contentTypeToExt := map[string]string{
-		"image/jpeg": ".jpg",
-		"image/png":  ".png",
-		"image/gif":  ".gif",
+// saveSettings returns the settings images are saved with, to record them in
+// the manifest
+func (f Finder) saveSettings() SaveSettings {
+	settings := SaveSettings{
+		ThumbnailsGIF: f.thumbnails.GIF,
+		Provenance:    f.provenance,
+		StripMetadata: f.stripMetadata,
+	}
+
+	if f.conversion.ContentType != "" {
+		settings.Quality = f.conversion.Quality
+		settings.Background = formatColor(f.conversion.Background)
+		settings.ConvertGIF = f.conversion.GIF
+	}
+
+	return settings
+}
+
+// imagePath decides where to save an image using the namer, making sure no
+// other image of the run is saved to the same path.
+func (f Finder) imagePath(request imageRequest, ext string, saver imageSaver) (string, error) {
+	name, err := f.namer.Name(f.nameData(request, ext, saver))
+	if err != nil {
+		return "", err
+	}
+
+	path, err := f.reservePath(filepath.Join(saver.basePath, name), saver)
+	if err != nil {
+		return "", err
 	}
 
+	// Templates may save images into subdirectories
+	if dir := filepath.Dir(path); dir != filepath.Clean(saver.basePath) {
+		err = f.fileSystem.MkdirAll(dir, 0777)
+		if err != nil {
+			return "", fmt.Errorf("creating directory %s: %s", dir, err)
+		}
+	}
+
+	return path, nil
+}
+
+// imageStem returns where an image will be saved, without the extension. Long
+// names are truncated to fit the extension, and all the image extensions are
+// as long, so any of them gives the stem the image is saved with.
+func (f Finder) imageStem(request imageRequest, saver imageSaver) (string, error) {
+	ext := imageExtensions()[0]
+
+	name, err := f.namer.Name(f.nameData(request, ext, saver))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(saver.basePath, strings.TrimSuffix(name, ext)), nil
+}
+
+func (f Finder) nameData(request imageRequest, ext string, saver imageSaver) NameData {
+	return NameData{
+		Index: request.index,
+		ID1:   request.image.ID1,
+		ID2:   request.image.ID2,
+		Slug:  request.image.Slug,
+		Title: request.image.Title,
+		Date:  saver.date,
+		Site:  request.image.Site,
+		Ext:   ext,
+	}
+}
+
+// contentTypeToExt maps the image content types we know how to save to their
+// file extensions.
+var contentTypeToExt = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+func detectFileExtension(contentType string) (string, error) {
 	ext, ok := contentTypeToExt[contentType]
 	if !ok {
 		return "", fmt.Errorf("unexpected content type '%s'", contentType)
@@ -1,12 +1,11 @@
 package imgfinder_test
 
 import (
+	"cat-scraper/catscraper/catscrapertest"
 	"cat-scraper/internal/imgfinder"
 	"errors"
 	"fmt"
 	"net/http"
-	"net/http/httptest"
-	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -23,22 +22,19 @@ func TestDownloadsFoundImages(t *testing.T) {
 		},
 	}
 
-	getter := StaticGetter{
-		ResponseByURL: map[string]Response{
-			url: {Content: content, ContentType: "image/jpeg", StatusCode: http.StatusOK},
-		},
-	}
-	writer := &MockFileWriter{}
+	getter := catscrapertest.NewGetter()
+	getter.Handle(url, catscrapertest.Response{Content: content, ContentType: "image/jpeg", StatusCode: http.StatusOK})
+	writer := catscrapertest.NewFileSystem()
 
 	finder := imgfinder.New(scrapper, writer, getter)
 
 	err := finder.CollectAndDownloadImages(1, 1, "images/")
 	require.NoError(t, err)
 
-	writer.AssertCreatedDirectories(t, "images/")
-	writer.AssertWroteFiles(t,
-		file{Content: content, Name: "images/1.jpg"},
-	)
+	assert.Equal(t, []string{"images"}, writer.Dirs())
+	assert.Equal(t, map[string][]byte{
+		"images/1.jpg": content,
+	}, writer.Files())
 }
 
 func TestGoesToTheNextPageAndPicksExtension(t *testing.T) {
@@ -59,15 +55,12 @@ func TestGoesToTheNextPageAndPicksExtension(t *testing.T) {
 		},
 	}
 
-	getter := StaticGetter{
-		ResponseByURL: map[string]Response{
-			url:       {Content: content, ContentType: "image/jpeg", StatusCode: http.StatusOK},
-			secondURL: {Content: secondContent, ContentType: "image/png", StatusCode: http.StatusOK},
-			thirdURL:  {Content: thirdContent, ContentType: "image/gif", StatusCode: http.StatusOK},
-		},
-	}
+	getter := catscrapertest.NewGetter()
+	getter.Handle(url, catscrapertest.Response{Content: content, ContentType: "image/jpeg", StatusCode: http.StatusOK})
+	getter.Handle(secondURL, catscrapertest.Response{Content: secondContent, ContentType: "image/png", StatusCode: http.StatusOK})
+	getter.Handle(thirdURL, catscrapertest.Response{Content: thirdContent, ContentType: "image/gif", StatusCode: http.StatusOK})
 
-	writer := &MockFileWriter{}
+	writer := catscrapertest.NewFileSystem()
 
 	finder := imgfinder.New(scrapper, writer, getter)
 
@@ -76,12 +69,12 @@ func TestGoesToTheNextPageAndPicksExtension(t *testing.T) {
 
 	// It writes the content obtained from the URLs, picking the correct
 	// extension based on the content type.
-	writer.AssertCreatedDirectories(t, "images/")
-	writer.AssertWroteFiles(t,
-		file{Content: content, Name: "images/1.jpg"},
-		file{Content: secondContent, Name: "images/2.png"},
-		file{Content: thirdContent, Name: "images/3.gif"},
-	)
+	assert.Equal(t, []string{"images"}, writer.Dirs())
+	assert.Equal(t, map[string][]byte{
+		"images/1.jpg": content,
+		"images/2.png": secondContent,
+		"images/3.gif": thirdContent,
+	}, writer.Files())
 }
 
 func TestIgnoresDuplicatedURLs(t *testing.T) {
@@ -98,14 +91,11 @@ func TestIgnoresDuplicatedURLs(t *testing.T) {
 		},
 	}
 
-	getter := StaticGetter{
-		ResponseByURL: map[string]Response{
-			url:       {Content: content, ContentType: "image/jpeg", StatusCode: http.StatusOK},
-			secondURL: {Content: secondContent, ContentType: "image/png", StatusCode: http.StatusOK},
-		},
-	}
+	getter := catscrapertest.NewGetter()
+	getter.Handle(url, catscrapertest.Response{Content: content, ContentType: "image/jpeg", StatusCode: http.StatusOK})
+	getter.Handle(secondURL, catscrapertest.Response{Content: secondContent, ContentType: "image/png", StatusCode: http.StatusOK})
 
-	writer := &MockFileWriter{}
+	writer := catscrapertest.NewFileSystem()
 
 	finder := imgfinder.New(scrapper, writer, getter)
 
@@ -114,11 +104,46 @@ func TestIgnoresDuplicatedURLs(t *testing.T) {
 
 	// Despite getting 4 URLs from the scrapper, it only downloads and saves 2
 	// (the unique ones)
-	writer.AssertCreatedDirectories(t, "images/")
-	writer.AssertWroteFiles(t,
-		file{Content: content, Name: "images/1.jpg"},
-		file{Content: secondContent, Name: "images/2.png"},
-	)
+	assert.Equal(t, []string{"images"}, writer.Dirs())
+	assert.Equal(t, map[string][]byte{
+		"images/1.jpg": content,
+		"images/2.png": secondContent,
+	}, writer.Files())
+}
+
+func TestNamesImagesWithTemplateWithoutCollisions(t *testing.T) {
+	const url = "https://i.chzbgr.com/full/9730332160/h6860EF7A"
+	const secondURL = "https://i.chzbgr.com/full/2/h6860EF7A"
+	const thirdURL = "https://i.chzbgr.com/full/3/h6860EF7A"
+
+	scrapper := MockScrapper{
+		URLsByPage: map[string][]string{
+			"https://icanhas.cheezburger.com/": {url, secondURL, thirdURL},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle(url, catscrapertest.Response{Content: []byte("1"), ContentType: "image/jpeg", StatusCode: http.StatusOK})
+	getter.Handle(secondURL, catscrapertest.Response{Content: []byte("2"), ContentType: "image/jpeg", StatusCode: http.StatusOK})
+	getter.Handle(thirdURL, catscrapertest.Response{Content: []byte("3"), ContentType: "image/png", StatusCode: http.StatusOK})
+
+	writer := catscrapertest.NewFileSystem()
+
+	// Every image gets the same name, but they can't overwrite each other
+	namer, err := imgfinder.NewNamer("{{.Site}}/meme{{.Ext}}")
+	require.NoError(t, err)
+
+	finder := imgfinder.New(scrapper, writer, getter).WithNamer(namer)
+
+	err = finder.CollectAndDownloadImages(3, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"images", "images/icanhas"}, writer.Dirs())
+	assert.Equal(t, map[string][]byte{
+		"images/icanhas/meme.jpg":   []byte("1"),
+		"images/icanhas/meme-2.jpg": []byte("2"),
+		"images/icanhas/meme.png":   []byte("3"),
+	}, writer.Files())
 }
 
 func TestScrapError(t *testing.T) {
@@ -126,8 +151,8 @@ func TestScrapError(t *testing.T) {
 		Error: errors.New("failed"),
 	}
 
-	getter := StaticGetter{}
-	writer := &MockFileWriter{}
+	getter := catscrapertest.NewGetter()
+	writer := catscrapertest.NewFileSystem()
 
 	finder := imgfinder.New(scrapper, writer, getter)
 
@@ -145,14 +170,10 @@ func TestCreateDirectoryError(t *testing.T) {
 		},
 	}
 
-	getter := StaticGetter{
-		ResponseByURL: map[string]Response{
-			url: {Content: content, ContentType: "image/jpeg", StatusCode: http.StatusOK},
-		},
-	}
-	writer := &MockFileWriter{
-		MkdirErr: errors.New("failed"),
-	}
+	getter := catscrapertest.NewGetter()
+	getter.Handle(url, catscrapertest.Response{Content: content, ContentType: "image/jpeg", StatusCode: http.StatusOK})
+	writer := catscrapertest.NewFileSystem()
+	writer.FailOn(catscrapertest.OpMkdirAll, "", errors.New("failed"))
 
 	finder := imgfinder.New(scrapper, writer, getter)
 
@@ -170,14 +191,10 @@ func TestSaveFileError(t *testing.T) {
 		},
 	}
 
-	getter := StaticGetter{
-		ResponseByURL: map[string]Response{
-			url: {Content: content, ContentType: "image/jpeg", StatusCode: http.StatusOK},
-		},
-	}
-	writer := &MockFileWriter{
-		WriteErr: errors.New("failed"),
-	}
+	getter := catscrapertest.NewGetter()
+	getter.Handle(url, catscrapertest.Response{Content: content, ContentType: "image/jpeg", StatusCode: http.StatusOK})
+	writer := catscrapertest.NewFileSystem()
+	writer.FailOn(catscrapertest.OpWriteFile, "", errors.New("failed"))
 
 	finder := imgfinder.New(scrapper, writer, getter)
 
@@ -195,13 +212,10 @@ func TestImageDownloadUnexpectedContentType(t *testing.T) {
 		},
 	}
 
-	getter := StaticGetter{
-		ResponseByURL: map[string]Response{
-			url: {Content: content, ContentType: "invalid content type", StatusCode: http.StatusOK},
-		},
-	}
+	getter := catscrapertest.NewGetter()
+	getter.Handle(url, catscrapertest.Response{Content: content, ContentType: "invalid content type", StatusCode: http.StatusOK})
 
-	writer := &MockFileWriter{}
+	writer := catscrapertest.NewFileSystem()
 
 	finder := imgfinder.New(scrapper, writer, getter)
 
@@ -219,13 +233,10 @@ func TestImageDownloadUnexpectedStatusCode(t *testing.T) {
 		},
 	}
 
-	getter := StaticGetter{
-		ResponseByURL: map[string]Response{
-			url: {Content: content, ContentType: "image/png", StatusCode: http.StatusInternalServerError},
-		},
-	}
+	getter := catscrapertest.NewGetter()
+	getter.Handle(url, catscrapertest.Response{Content: content, ContentType: "image/png", StatusCode: http.StatusInternalServerError})
 
-	writer := &MockFileWriter{}
+	writer := catscrapertest.NewFileSystem()
 
 	finder := imgfinder.New(scrapper, writer, getter)
 
@@ -233,95 +244,32 @@ func TestImageDownloadUnexpectedStatusCode(t *testing.T) {
 	require.EqualError(t, err, "downloading images: downloading image https://i.chzbgr.com/full/9730332160/h6860EF7A: unexpected status code '500' expected 200 OK")
 }
 
-type MockFileWriter struct {
-	writtenFiles []file
-	WriteErr     error
-
-	createdDirectories []string
-	MkdirErr           error
-}
-
-type file struct {
-	Name    string
-	Content []byte
-}
-
-func (m *MockFileWriter) WriteFile(name string, data []byte, _ os.FileMode) error {
-	if m.WriteErr != nil {
-		return m.WriteErr
-	}
-
-	m.writtenFiles = append(m.writtenFiles, file{Name: name, Content: data})
-	return nil
-}
-
-func (m *MockFileWriter) MkdirAll(name string, _ os.FileMode) error {
-	if m.MkdirErr != nil {
-		return m.MkdirErr
-	}
-
-	m.createdDirectories = append(m.createdDirectories, name)
-	return nil
-}
-
-func (m *MockFileWriter) AssertWroteFiles(t *testing.T, expectedFiles ...file) {
-	// Check the elements match but not the order, because when executed with
-	// threads they may be written in a different order than obtained.
-	assert.ElementsMatch(t, expectedFiles, m.writtenFiles)
-}
-
-func (m *MockFileWriter) AssertCreatedDirectories(t *testing.T, expectedDirectories ...string) {
-	assert.ElementsMatch(t, expectedDirectories, m.createdDirectories)
-}
-
 type MockScrapper struct {
 	URLsByPage map[string][]string
-	Error      error
+	// ImagesByPage are returned as they are, instead of building them from
+	// URLsByPage
+	ImagesByPage map[string][]imgfinder.Image
+	Error        error
 }
 
-func (s MockScrapper) CollectImageURLsFrom(pageURL string) ([]string, error) {
+func (s MockScrapper) CollectImagesFrom(pageURL string) ([]imgfinder.Image, error) {
 	if s.Error != nil {
 		return nil, s.Error
 	}
 
-	urls, ok := s.URLsByPage[pageURL]
-	if !ok {
-		return nil, fmt.Errorf("url '%s' not found", pageURL)
-	}
-
-	return urls, nil
-}
-
-type StaticGetter struct {
-	ResponseByURL map[string]Response
-
-	Err error
-}
-
-type Response struct {
-	Content     []byte
-	ContentType string
-	StatusCode  int
-}
-
-func (s StaticGetter) Get(url string) (*http.Response, error) {
-	if s.Err != nil {
-		return nil, s.Err
+	if images, ok := s.ImagesByPage[pageURL]; ok {
+		return images, nil
 	}
 
-	response, ok := s.ResponseByURL[url]
+	urls, ok := s.URLsByPage[pageURL]
 	if !ok {
-		return nil, fmt.Errorf("url '%s' not found", url)
+		return nil, fmt.Errorf("url '%s' not found", pageURL)
 	}
 
-	rec := httptest.NewRecorder()
-	if response.Content != nil {
-		rec.Write(response.Content)
+	var images []imgfinder.Image
+	for _, url := range urls {
+		images = append(images, imgfinder.Image{URL: url})
 	}
 
-	resp := rec.Result()
-	resp.Header.Set("Content-Type", response.ContentType)
-	resp.StatusCode = response.StatusCode
-
-	return resp, nil
+	return images, nil
 }
@@ -0,0 +1,486 @@
+package imgfinder
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A library is an images directory with its manifest
+
+// PartialSuffix is the suffix of files being written. Files with it are left
+// behind by interrupted runs.
+const PartialSuffix = ".part"
+
+// tempSuffix is the suffix of temporary files, like the ones of the cache
+const tempSuffix = ".tmp"
+
+// ProblemKind is what's wrong with a file of a library
+type ProblemKind string
+
+const (
+	// ProblemMissing is a file of the manifest that isn't there
+	ProblemMissing ProblemKind = "missing"
+	// ProblemMismatched is a file with another size or hash than when it
+	// was saved
+	ProblemMismatched ProblemKind = "mismatched"
+	// ProblemCorrupt is a file that can't be decoded as an image, e.g.
+	// because it's truncated
+	ProblemCorrupt ProblemKind = "corrupt"
+	// ProblemExtra is an image that isn't in the manifest
+	ProblemExtra ProblemKind = "extra"
+)
+
+// A LibraryProblem is a file of a library that doesn't match its manifest
+type LibraryProblem struct {
+	// Path of the file relative to the images directory
+	Path    string
+	Kind    ProblemKind
+	Problem string
+}
+
+func (p LibraryProblem) String() string {
+	return p.Path + ": " + p.Problem
+}
+
+// VerifyLibrary checks that the images of the manifest of dir are there, with
+// the size and hash they were saved with, that they and their thumbnails can
+// be decoded, and that no image is missing from the manifest.
+func (f Finder) VerifyLibrary(dir string) ([]LibraryProblem, error) {
+	manifest, err := ReadManifest(f.fileSystem, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []LibraryProblem
+	tracked := map[string]bool{}
+
+	for _, entry := range manifest.Images {
+		tracked[entry.Path] = true
+
+		problem, err := f.checkImage(dir, entry)
+		if err != nil {
+			return nil, err
+		}
+
+		if problem != nil {
+			problems = append(problems, *problem)
+		}
+
+		for _, thumbnail := range entry.Thumbnails {
+			tracked[thumbnail] = true
+
+			problem, err := f.checkThumbnail(dir, entry, thumbnail)
+			if err != nil {
+				return nil, err
+			}
+
+			if problem != nil {
+				problems = append(problems, *problem)
+			}
+		}
+	}
+
+	files, err := f.libraryFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		if !tracked[file] && isImageExtension(path.Ext(file)) {
+			problems = append(problems, LibraryProblem{Path: file, Kind: ProblemExtra, Problem: "not in the manifest"})
+		}
+	}
+
+	return problems, nil
+}
+
+// checkImage returns what's wrong with the image of a manifest entry, if
+// anything
+func (f Finder) checkImage(dir string, entry ManifestEntry) (*LibraryProblem, error) {
+	data, err := f.fileSystem.ReadFile(filepath.Join(dir, filepath.FromSlash(entry.Path)))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return &LibraryProblem{Path: entry.Path, Kind: ProblemMissing, Problem: "missing"}, nil
+	case err != nil:
+		return nil, fmt.Errorf("reading %s: %s", entry.Path, err)
+	case len(data) != entry.Size:
+		return &LibraryProblem{
+			Path:    entry.Path,
+			Kind:    ProblemMismatched,
+			Problem: fmt.Sprintf("has %d bytes, expected %d", len(data), entry.Size),
+		}, nil
+	case sha256Hex(data) != entry.SHA256:
+		return &LibraryProblem{Path: entry.Path, Kind: ProblemMismatched, Problem: "has a different SHA-256 than when it was saved"}, nil
+	}
+
+	// Images can be broken when they were saved, e.g. by a truncated
+	// download
+	err = decodeImage(data, path.Ext(entry.Path))
+	if err != nil {
+		return &LibraryProblem{Path: entry.Path, Kind: ProblemCorrupt, Problem: "can't be decoded: " + err.Error()}, nil
+	}
+
+	return nil, nil
+}
+
+// checkThumbnail returns what's wrong with a thumbnail of a manifest entry, if
+// anything. Thumbnails have no size or hash in the manifest.
+func (f Finder) checkThumbnail(dir string, entry ManifestEntry, thumbnail string) (*LibraryProblem, error) {
+	data, err := f.fileSystem.ReadFile(filepath.Join(dir, filepath.FromSlash(thumbnail)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &LibraryProblem{Path: thumbnail, Kind: ProblemMissing, Problem: "missing thumbnail of " + entry.Path}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %s", thumbnail, err)
+	}
+
+	err = decodeImage(data, path.Ext(thumbnail))
+	if err != nil {
+		return &LibraryProblem{
+			Path:    thumbnail,
+			Kind:    ProblemCorrupt,
+			Problem: fmt.Sprintf("thumbnail of %s can't be decoded: %s", entry.Path, err),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// decodeImage decodes an image with the given extension, every frame of it
+// for GIFs, to find out if it's broken
+func decodeImage(data []byte, ext string) error {
+	var err error
+	if ext == ".gif" {
+		_, err = gif.DecodeAll(bytes.NewReader(data))
+	} else {
+		_, _, err = image.Decode(bytes.NewReader(data))
+	}
+
+	return err
+}
+
+// RepairLibrary fixes the problems VerifyLibrary found in dir where it can.
+// Images that are missing, mismatched or corrupt are downloaded again from the
+// URL they were saved from and saved again with the settings of their manifest
+// entry, and their thumbnails are generated again. Broken thumbnails of good images are
+// generated from them. The manifest is updated with the new images, and the
+// paths of the repaired images are returned. Extra images are left alone.
+func (f Finder) RepairLibrary(dir string, problems []LibraryProblem) ([]string, error) {
+	manifest, err := ReadManifest(f.fileSystem, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	broken := map[string]bool{}
+	for _, problem := range problems {
+		if problem.Kind != ProblemExtra {
+			broken[problem.Path] = true
+		}
+	}
+
+	var repaired []string
+	for i, entry := range manifest.Images {
+		brokenThumbnails := false
+		for _, thumbnail := range entry.Thumbnails {
+			brokenThumbnails = brokenThumbnails || broken[thumbnail]
+		}
+
+		if !broken[entry.Path] && !brokenThumbnails {
+			continue
+		}
+
+		entry, err := f.repairEntry(dir, entry, broken[entry.Path])
+		if err != nil {
+			return repaired, fmt.Errorf("repairing %s: %s", entry.Path, err)
+		}
+
+		manifest.Images[i] = entry
+		repaired = append(repaired, entry.Path)
+
+		// Saved after every image, so the ones already repaired are kept
+		// if a later one fails
+		err = manifest.Save(f.fileSystem, dir)
+		if err != nil {
+			return repaired, err
+		}
+	}
+
+	return repaired, nil
+}
+
+// repairEntry saves the image of a manifest entry again, downloading it if
+// it's broken, and its thumbnails. It returns the updated entry.
+func (f Finder) repairEntry(dir string, entry ManifestEntry, brokenImage bool) (ManifestEntry, error) {
+	imagePath := filepath.Join(dir, filepath.FromSlash(entry.Path))
+
+	var data []byte
+	var err error
+	if brokenImage {
+		data, err = f.redownload(entry)
+		if err != nil {
+			return entry, err
+		}
+
+		if entry.Settings.StripMetadata {
+			data, entry.LocationRemoved, err = stripMetadata(data, entry.SavedType)
+			if err != nil {
+				return entry, fmt.Errorf("stripping metadata: %s", err)
+			}
+		}
+
+		entry.DownloadedAt = time.Now().UTC()
+		if entry.Settings.Provenance {
+			data, err = embedProvenance(data, entry.SavedType, Provenance{
+				SourceURL:    entry.URL,
+				Title:        entry.Title,
+				Site:         entry.Site,
+				DownloadedAt: entry.DownloadedAt,
+			})
+			if err != nil {
+				return entry, fmt.Errorf("embedding provenance: %s", err)
+			}
+		}
+
+		err = f.fileSystem.WriteFile(imagePath, data, 0777)
+		if err != nil {
+			return entry, fmt.Errorf("saving: %s", err)
+		}
+
+		entry.Size = len(data)
+		entry.SHA256 = sha256Hex(data)
+	} else {
+		data, err = f.fileSystem.ReadFile(imagePath)
+		if err != nil {
+			return entry, err
+		}
+	}
+
+	return entry, f.repairThumbnails(dir, entry, data)
+}
+
+// redownload downloads the image of a manifest entry and converts it to the
+// type it was saved as, with the settings it was saved with
+func (f Finder) redownload(entry ManifestEntry) ([]byte, error) {
+	resp, err := f.getter.Get(entry.URL)
+	if err != nil {
+		return nil, fmt.Errorf("downloading %s: %s", entry.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: unexpected status code '%d' expected 200 OK", entry.URL, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %s", err)
+	}
+
+	conversion, err := entry.Settings.conversion(entry.SavedType)
+	if err != nil {
+		return nil, err
+	}
+
+	body, _, err = conversion.convert(body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("converting: %s", err)
+	}
+
+	err = decodeImage(body, path.Ext(entry.Path))
+	if err != nil {
+		return nil, fmt.Errorf("downloaded image can't be decoded: %s", err)
+	}
+
+	return body, nil
+}
+
+// repairThumbnails generates the thumbnails of a manifest entry again from its
+// image data
+func (f Finder) repairThumbnails(dir string, entry ManifestEntry, data []byte) error {
+	for _, thumbnail := range entry.Thumbnails {
+		width, ok := thumbnailWidth(entry.Path, thumbnail)
+		if !ok {
+			return fmt.Errorf("unexpected thumbnail name %s", thumbnail)
+		}
+
+		thumbnails, err := makeThumbnails(data, path.Ext(entry.Path), Thumbnails{Widths: []int{width}, GIF: entry.Settings.ThumbnailsGIF})
+		if err != nil {
+			return fmt.Errorf("generating thumbnails: %s", err)
+		}
+
+		encoded, ok := thumbnails[width]
+		if !ok {
+			return fmt.Errorf("image is narrower than its thumbnail %s", thumbnail)
+		}
+
+		err = f.fileSystem.WriteFile(filepath.Join(dir, filepath.FromSlash(thumbnail)), encoded, 0777)
+		if err != nil {
+			return fmt.Errorf("saving thumbnail: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// thumbnailWidth returns the width of a thumbnail from its name, the opposite
+// of thumbnailPath
+func thumbnailWidth(imagePath string, thumbnail string) (int, bool) {
+	ext := path.Ext(imagePath)
+	prefix := path.Base(strings.TrimSuffix(imagePath, ext)) + ".thumb"
+
+	name := path.Base(thumbnail)
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+		return 0, false
+	}
+
+	width, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext))
+	if err != nil || width < 1 {
+		return 0, false
+	}
+
+	return width, true
+}
+
+// LibraryStats summarizes the images of a library
+type LibraryStats struct {
+	Images     int
+	Bytes      int64
+	Thumbnails int
+
+	// Counts of images by site, section and saved content type
+	Sites    map[string]int
+	Sections map[Section]int
+	Types    map[string]int
+
+	// The range of when the images were downloaded
+	FirstDownloaded time.Time
+	LastDownloaded  time.Time
+}
+
+// LibraryStats summarizes the library of dir from its manifest
+func (f Finder) LibraryStats(dir string) (LibraryStats, error) {
+	manifest, err := ReadManifest(f.fileSystem, dir)
+	if err != nil {
+		return LibraryStats{}, err
+	}
+
+	stats := LibraryStats{
+		Sites:    map[string]int{},
+		Sections: map[Section]int{},
+		Types:    map[string]int{},
+	}
+
+	for _, entry := range manifest.Images {
+		stats.Images++
+		stats.Bytes += int64(entry.Size)
+		stats.Thumbnails += len(entry.Thumbnails)
+
+		if entry.Site != "" {
+			stats.Sites[entry.Site]++
+		}
+
+		if entry.Section != "" {
+			stats.Sections[entry.Section]++
+		}
+		stats.Types[entry.SavedType]++
+
+		stats.FirstDownloaded, stats.LastDownloaded = widenRange(stats.FirstDownloaded, stats.LastDownloaded, entry.DownloadedAt)
+	}
+
+	return stats, nil
+}
+
+// widenRange returns the range from first to last including t
+func widenRange(first time.Time, last time.Time, t time.Time) (time.Time, time.Time) {
+	if first.IsZero() || t.Before(first) {
+		first = t
+	}
+
+	if last.IsZero() || t.After(last) {
+		last = t
+	}
+
+	return first, last
+}
+
+// CleanLibrary removes the partial and temporary files left behind in dir by
+// interrupted runs, and returns their paths relative to dir. With dryRun they
+// are only returned.
+func (f Finder) CleanLibrary(dir string, dryRun bool) ([]string, error) {
+	files, err := f.libraryFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	for _, file := range files {
+		if !strings.HasSuffix(file, PartialSuffix) && !strings.HasSuffix(file, tempSuffix) {
+			continue
+		}
+
+		if !dryRun {
+			err := f.fileSystem.Remove(filepath.Join(dir, filepath.FromSlash(file)))
+			if err != nil {
+				return removed, fmt.Errorf("removing %s: %s", file, err)
+			}
+		}
+
+		removed = append(removed, file)
+	}
+
+	return removed, nil
+}
+
+// libraryFiles returns the paths of every file in dir and its subdirectories,
+// relative to dir with / separators and sorted
+func (f Finder) libraryFiles(dir string) ([]string, error) {
+	var files []string
+
+	var walk func(subdir string) error
+	walk = func(subdir string) error {
+		entries, err := f.fileSystem.ReadDir(filepath.Join(dir, filepath.FromSlash(subdir)))
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			name := path.Join(subdir, entry.Name())
+			if entry.IsDir() {
+				err := walk(name)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			files = append(files, name)
+		}
+
+		return nil
+	}
+
+	err := walk("")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %s", dir, err)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,217 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func manifestEntry(path string, content string) imgfinder.ManifestEntry {
+	sum := sha256.Sum256([]byte(content))
+	return imgfinder.ManifestEntry{Path: path, Size: len(content), SHA256: hex.EncodeToString(sum[:]), SavedType: "image/jpeg"}
+}
+
+func newLibrary(t *testing.T, entries []imgfinder.ManifestEntry, files map[string]string) (imgfinder.Finder, *catscrapertest.FileSystem) {
+	t.Helper()
+
+	writer := catscrapertest.NewFileSystem()
+	require.NoError(t, writer.MkdirAll("images/thumbs", 0777))
+	require.NoError(t, imgfinder.Manifest{Images: entries}.Save(writer, "images"))
+
+	for name, content := range files {
+		require.NoError(t, writer.WriteFile(filepath.Join("images", name), []byte(content), 0777))
+	}
+
+	return imgfinder.New(MockScrapper{}, writer, catscrapertest.NewGetter()), writer
+}
+
+func TestVerifyLibrary(t *testing.T) {
+	image := string(encodedPNG(t, 20, 10))
+	thumbnail := string(encodedPNG(t, 10, 5))
+
+	withThumbnail := manifestEntry("5.png", image)
+	withThumbnail.Thumbnails = []string{"thumbs/5.thumb10.png"}
+
+	withBrokenThumbnail := manifestEntry("7.png", image)
+	withBrokenThumbnail.Thumbnails = []string{"7.thumb10.png"}
+
+	finder, _ := newLibrary(t, []imgfinder.ManifestEntry{
+		manifestEntry("1.png", image),
+		manifestEntry("2.png", image),
+		manifestEntry("3.png", image),
+		manifestEntry("4.png", image),
+		withThumbnail,
+		manifestEntry("8.png", image[:len(image)-20]),
+		withBrokenThumbnail,
+	}, map[string]string{
+		"1.png":         image,
+		"3.png":         image + "longer",
+		"4.png":         strings.Replace(image, "PNG", "png", 1),
+		"5.png":         image,
+		"6.png":         image,
+		"7.png":         image,
+		"7.thumb10.png": thumbnail[:len(thumbnail)/2],
+		// Truncated when it was saved, so it matches the manifest
+		"8.png": image[:len(image)-20],
+	})
+
+	problems, err := finder.VerifyLibrary("images")
+	require.NoError(t, err)
+	require.Len(t, problems, 7)
+	assert.Equal(t, []imgfinder.LibraryProblem{
+		{Path: "2.png", Kind: imgfinder.ProblemMissing, Problem: "missing"},
+		{Path: "3.png", Kind: imgfinder.ProblemMismatched, Problem: fmt.Sprintf("has %d bytes, expected %d", len(image)+6, len(image))},
+		{Path: "4.png", Kind: imgfinder.ProblemMismatched, Problem: "has a different SHA-256 than when it was saved"},
+		{Path: "thumbs/5.thumb10.png", Kind: imgfinder.ProblemMissing, Problem: "missing thumbnail of 5.png"},
+	}, problems[:4])
+
+	assert.Equal(t, "7.thumb10.png", problems[4].Path)
+	assert.Equal(t, imgfinder.ProblemCorrupt, problems[4].Kind)
+	assert.Contains(t, problems[4].Problem, "thumbnail of 7.png can't be decoded")
+	assert.Equal(t, imgfinder.LibraryProblem{Path: "8.png", Kind: imgfinder.ProblemCorrupt, Problem: "can't be decoded: png: invalid format: unexpected EOF"}, problems[5])
+	assert.Equal(t, imgfinder.LibraryProblem{Path: "6.png", Kind: imgfinder.ProblemExtra, Problem: "not in the manifest"}, problems[6])
+}
+
+func TestRepairLibrary(t *testing.T) {
+	image := encodedPNG(t, 20, 10)
+
+	missing := manifestEntry("1.png", string(image))
+	missing.URL = "https://i.chzbgr.com/full/1/a"
+
+	truncated := manifestEntry("2.png", string(image))
+	truncated.URL = "https://i.chzbgr.com/full/2/b"
+	truncated.Thumbnails = []string{"2.thumb10.png"}
+
+	// Saved as a JPEG from a PNG
+	converted := manifestEntry("3.jpg", "")
+	converted.URL = "https://i.chzbgr.com/full/3/c"
+	converted.OriginalType = "image/png"
+
+	withoutThumbnail := manifestEntry("4.png", string(image))
+	withoutThumbnail.Thumbnails = []string{"4.thumb10.png"}
+
+	finder, writer := newLibrary(t, []imgfinder.ManifestEntry{missing, truncated, converted, withoutThumbnail, manifestEntry("5.png", string(image))}, map[string]string{
+		"2.png":         string(image[:len(image)/2]),
+		"2.thumb10.png": "thumbnail",
+		"4.png":         string(image),
+		"5.png":         string(image),
+		"6.png":         string(image),
+	})
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle("", catscrapertest.Response{Content: image, ContentType: "image/png"})
+	finder = finder.WithGetter(getter)
+
+	problems, err := finder.VerifyLibrary("images")
+	require.NoError(t, err)
+	require.Len(t, problems, 6)
+
+	repaired, err := finder.RepairLibrary("images", problems)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1.png", "2.png", "3.jpg", "4.png"}, repaired)
+	assert.Equal(t, []string{"https://i.chzbgr.com/full/1/a", "https://i.chzbgr.com/full/2/b", "https://i.chzbgr.com/full/3/c"}, getter.Requests())
+
+	jpeg, err := writer.ReadFile("images/3.jpg")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xff, 0xd8}, jpeg[:2])
+
+	// Only the extra image is left
+	problems, err = finder.VerifyLibrary("images")
+	require.NoError(t, err)
+	assert.Equal(t, []imgfinder.LibraryProblem{{Path: "6.png", Kind: imgfinder.ProblemExtra, Problem: "not in the manifest"}}, problems)
+}
+
+func TestRepairLibraryWithSavedSettings(t *testing.T) {
+	image := encodedPNG(t, 20, 10)
+
+	entry := manifestEntry("1.png", string(image))
+	entry.URL = "https://i.chzbgr.com/full/1/a"
+	entry.Title = "Grumpy cat"
+	entry.SavedType = "image/png"
+	entry.Settings = imgfinder.SaveSettings{Provenance: true}
+
+	// The finder doesn't embed provenance, the settings of the entry do
+	finder, _ := newLibrary(t, []imgfinder.ManifestEntry{entry}, nil)
+	getter := catscrapertest.NewGetter()
+	getter.Handle("", catscrapertest.Response{Content: image, ContentType: "image/png"})
+	finder = finder.WithGetter(getter)
+
+	problems, err := finder.VerifyLibrary("images")
+	require.NoError(t, err)
+
+	_, err = finder.RepairLibrary("images", problems)
+	require.NoError(t, err)
+
+	provenance, err := finder.ReadProvenance("images/1.png")
+	require.NoError(t, err)
+	assert.Equal(t, "https://i.chzbgr.com/full/1/a", provenance.SourceURL)
+	assert.Equal(t, "Grumpy cat", provenance.Title)
+}
+
+func TestLibraryStats(t *testing.T) {
+	downloaded := time.Date(2023, 2, 4, 12, 0, 0, 0, time.UTC)
+
+	first := manifestEntry("1.jpg", "one")
+	first.Site, first.Section, first.DownloadedAt = "icanhas", imgfinder.SectionFeed, downloaded
+	first.Thumbnails = []string{"1.thumb10.jpg"}
+
+	second := manifestEntry("2.png", "second")
+	second.Site, second.Section, second.SavedType, second.DownloadedAt = "memebase", imgfinder.SectionHot, "image/png", downloaded.Add(time.Hour)
+
+	finder, _ := newLibrary(t, []imgfinder.ManifestEntry{first, second}, nil)
+
+	stats, err := finder.LibraryStats("images")
+	require.NoError(t, err)
+	assert.Equal(t, imgfinder.LibraryStats{
+		Images:          2,
+		Bytes:           9,
+		Thumbnails:      1,
+		Sites:           map[string]int{"icanhas": 1, "memebase": 1},
+		Sections:        map[imgfinder.Section]int{imgfinder.SectionFeed: 1, imgfinder.SectionHot: 1},
+		Types:           map[string]int{"image/jpeg": 1, "image/png": 1},
+		FirstDownloaded: downloaded,
+		LastDownloaded:  downloaded.Add(time.Hour),
+	}, stats)
+}
+
+func TestCleanLibrary(t *testing.T) {
+	finder, writer := newLibrary(t, nil, map[string]string{
+		"1.jpg":             "one",
+		"2.jpg.part":        "tw",
+		"thumbs/3.jpg.part": "thr",
+		"cache.123.tmp":     "temp",
+	})
+
+	removed, err := finder.CleanLibrary("images", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2.jpg.part", "cache.123.tmp", "thumbs/3.jpg.part"}, removed)
+	assert.Len(t, writer.Files(), 5, "dry runs remove nothing")
+
+	removed, err = finder.CleanLibrary("images", false)
+	require.NoError(t, err)
+	assert.Len(t, removed, 3)
+	assert.Contains(t, writer.Files(), "images/1.jpg")
+	assert.Contains(t, writer.Files(), "images/manifest.json")
+}
+
+func TestRealFileSystemLeavesNoPartialFiles(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "1.jpg")
+
+	require.NoError(t, imgfinder.RealFileSystem{}.WriteFile(name, []byte("meme"), 0666))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "1.jpg", entries[0].Name())
+}
@@ -0,0 +1,186 @@
+package imgfinder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ManifestName is the name of the manifest saved in the images directory
+const ManifestName = "manifest.json"
+
+// A Manifest records every image saved to an images directory, across runs
+type Manifest struct {
+	Images []ManifestEntry `json:"images"`
+}
+
+// A ManifestEntry is an image saved to the images directory
+type ManifestEntry struct {
+	// Path of the image relative to the images directory, with / separators
+	Path string `json:"path"`
+	// URL is where the image was downloaded from
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	Site  string `json:"site,omitempty"`
+	// Section is the section of the page the image was found in
+	Section Section `json:"section,omitempty"`
+
+	// OriginalType is the content type the image was downloaded as, and
+	// SavedType the one it was saved as, which are different if it was
+	// converted.
+	OriginalType string `json:"original_type"`
+	SavedType    string `json:"saved_type"`
+
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+
+	// Thumbnails are the paths of the resized variants of the image,
+	// relative to the images directory
+	Thumbnails []string `json:"thumbnails,omitempty"`
+
+	DownloadedAt time.Time `json:"downloaded_at"`
+
+	// LocationRemoved is whether stripping the metadata of the image removed
+	// location data from it
+	LocationRemoved bool `json:"location_removed,omitempty"`
+
+	// Settings are how the image was saved, so it's saved the same way when
+	// it's repaired
+	Settings SaveSettings `json:"settings"`
+}
+
+// SaveSettings are the settings an image was saved with. The conversion ones
+// are only set if images were being converted.
+type SaveSettings struct {
+	Quality int `json:"quality,omitempty"`
+	// Background is a color in hex notation, e.g. #ffffff
+	Background    string            `json:"background,omitempty"`
+	ConvertGIF    GIFConversionMode `json:"convert_gif,omitempty"`
+	ThumbnailsGIF GIFThumbnailMode  `json:"thumbnails_gif,omitempty"`
+	Provenance    bool              `json:"provenance,omitempty"`
+	StripMetadata bool              `json:"strip_metadata,omitempty"`
+}
+
+// conversion returns the conversion of the settings to contentType
+func (s SaveSettings) conversion(contentType string) (Conversion, error) {
+	conversion := Conversion{ContentType: contentType, Quality: s.Quality, GIF: s.ConvertGIF}
+	if s.Background == "" {
+		return conversion, nil
+	}
+
+	var err error
+	conversion.Background, err = ParseColor(s.Background)
+	return conversion, err
+}
+
+// ReadManifest reads the manifest of an images directory. Directories without
+// one have an empty manifest.
+func ReadManifest(fileSystem FileSystem, dir string) (Manifest, error) {
+	path := filepath.Join(dir, ManifestName)
+
+	data, err := fileSystem.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Manifest{}, nil
+	}
+
+	if err != nil {
+		return Manifest{}, fmt.Errorf("reading %s: %s", path, err)
+	}
+
+	var manifest Manifest
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("parsing %s: %s", path, err)
+	}
+
+	return manifest, nil
+}
+
+// Save writes the manifest to an images directory, sorted by path
+func (m Manifest) Save(fileSystem FileSystem, dir string) error {
+	sort.Slice(m.Images, func(i, j int) bool { return m.Images[i].Path < m.Images[j].Path })
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, ManifestName)
+	err = fileSystem.WriteFile(path, data, 0777)
+	if err != nil {
+		return fmt.Errorf("saving %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// manifestChanges are the changes to the manifest made by a run. It is safe
+// for concurrent use.
+type manifestChanges struct {
+	mu      sync.Mutex
+	saved   map[string]ManifestEntry
+	removed map[string]bool
+}
+
+func newManifestChanges() *manifestChanges {
+	return &manifestChanges{
+		saved:   map[string]ManifestEntry{},
+		removed: map[string]bool{},
+	}
+}
+
+func (c *manifestChanges) save(entry ManifestEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.saved[entry.Path] = entry
+	delete(c.removed, entry.Path)
+}
+
+func (c *manifestChanges) remove(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removed[path] = true
+	delete(c.saved, path)
+}
+
+// updateManifest applies the changes of the run to the manifest of dir
+func (f Finder) updateManifest(dir string, changes *manifestChanges) error {
+	manifest, err := ReadManifest(f.fileSystem, dir)
+	if err != nil {
+		return err
+	}
+
+	changes.mu.Lock()
+	defer changes.mu.Unlock()
+
+	var images []ManifestEntry
+	for _, entry := range manifest.Images {
+		if _, saved := changes.saved[entry.Path]; !saved && !changes.removed[entry.Path] {
+			images = append(images, entry)
+		}
+	}
+
+	for _, entry := range changes.saved {
+		images = append(images, entry)
+	}
+
+	return Manifest{Images: images}.Save(f.fileSystem, dir)
+}
+
+// manifestPath returns the path of a file relative to the images directory,
+// as saved in the manifest
+func manifestPath(dir string, path string) string {
+	relative, err := filepath.Rel(filepath.Clean(dir), path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+
+	return filepath.ToSlash(relative)
+}
@@ -0,0 +1,116 @@
+package imgfinder_test
+
+import (
+	"bytes"
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestRecordsSavedImages(t *testing.T) {
+	var original bytes.Buffer
+	require.NoError(t, png.Encode(&original, image.NewRGBA(image.Rect(0, 0, 40, 20))))
+
+	finder, writer := newThumbnailFinder(original.Bytes(), "image/png")
+	finder = finder.
+		WithConversion(imgfinder.Conversion{ContentType: "image/jpeg", Quality: 70, Background: color.Black, GIF: imgfinder.GIFKeepAnimated}).
+		WithThumbnails(imgfinder.Thumbnails{Widths: []int{10}, GIF: imgfinder.GIFAllFrames}).
+		WithStripMetadata(true).
+		WithManifest(true)
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	manifest, err := imgfinder.ReadManifest(writer, "images/")
+	require.NoError(t, err)
+	require.Len(t, manifest.Images, 1)
+
+	entry := manifest.Images[0]
+	assert.Equal(t, "1.jpg", entry.Path)
+	assert.Equal(t, "https://i.chzbgr.com/full/9730332160/h6860EF7A", entry.URL)
+	assert.Equal(t, "image/png", entry.OriginalType)
+	assert.Equal(t, "image/jpeg", entry.SavedType)
+	assert.Equal(t, len(writer.Files()["images/1.jpg"]), entry.Size)
+	assert.Len(t, entry.SHA256, 64)
+	assert.Equal(t, []string{"1.thumb10.jpg"}, entry.Thumbnails)
+	assert.False(t, entry.DownloadedAt.IsZero())
+	assert.Equal(t, imgfinder.SaveSettings{
+		Quality:       70,
+		Background:    "#000000",
+		ConvertGIF:    imgfinder.GIFKeepAnimated,
+		ThumbnailsGIF: imgfinder.GIFAllFrames,
+		StripMetadata: true,
+	}, entry.Settings)
+}
+
+func TestManifestIsUpdatedAcrossRuns(t *testing.T) {
+	writer := catscrapertest.NewFileSystem()
+	require.NoError(t, writer.MkdirAll("images", 0777))
+
+	previous := imgfinder.Manifest{Images: []imgfinder.ManifestEntry{
+		{Path: "1.png", URL: "https://i.chzbgr.com/full/1/old"},
+		{Path: "7.jpg", URL: "https://i.chzbgr.com/full/7/kept"},
+	}}
+	require.NoError(t, previous.Save(writer, "images"))
+	require.NoError(t, writer.WriteFile("images/1.png", []byte("png"), 0777))
+
+	finder, _ := newThumbnailFinder([]byte("jpeg"), "image/jpeg")
+	err := finder.WithFileSystem(writer).WithManifest(true).CollectAndDownloadImages(1, 1, "images")
+	require.NoError(t, err)
+
+	manifest, err := imgfinder.ReadManifest(writer, "images")
+	require.NoError(t, err)
+	require.Len(t, manifest.Images, 2, "the stale 1.png is removed")
+	assert.Equal(t, "1.jpg", manifest.Images[0].Path)
+	assert.Equal(t, "7.jpg", manifest.Images[1].Path)
+}
+
+func TestManifestRecordsImagesSavedBeforeAFailure(t *testing.T) {
+	urls := []string{
+		"https://i.chzbgr.com/full/1/h6860EF7A",
+		"https://i.chzbgr.com/full/2/h6860EF7A",
+		"https://i.chzbgr.com/full/3/h6860EF7A",
+	}
+	scrapper := MockScrapper{URLsByPage: map[string][]string{"https://icanhas.cheezburger.com/": urls}}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle(urls[0], catscrapertest.Response{Content: []byte("jpeg"), ContentType: "image/jpeg"})
+	getter.Handle(urls[1], catscrapertest.Response{StatusCode: http.StatusInternalServerError})
+	getter.Handle(urls[2], catscrapertest.Response{Content: []byte("jpeg"), ContentType: "image/jpeg"})
+
+	writer := catscrapertest.NewFileSystem()
+	finder := imgfinder.New(scrapper, writer, getter).WithManifest(true)
+	err := finder.CollectAndDownloadImages(3, 1, "images")
+	require.Error(t, err)
+
+	manifest, err := imgfinder.ReadManifest(writer, "images")
+	require.NoError(t, err)
+	require.NotEmpty(t, manifest.Images)
+	assert.Equal(t, urls[0], manifest.Images[0].URL)
+	for _, entry := range manifest.Images {
+		assert.NotEqual(t, urls[1], entry.URL)
+	}
+}
+
+func TestWithoutManifest(t *testing.T) {
+	finder, writer := newThumbnailFinder([]byte("jpeg"), "image/jpeg")
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+	assert.NotContains(t, writer.Files(), "images/manifest.json")
+}
+
+func TestReadInvalidManifest(t *testing.T) {
+	writer := catscrapertest.NewFileSystem()
+	require.NoError(t, writer.WriteFile("manifest.json", []byte("{"), 0777))
+
+	_, err := imgfinder.ReadManifest(writer, ".")
+	require.EqualError(t, err, "parsing manifest.json: unexpected end of JSON input")
+}
@@ -0,0 +1,143 @@
+package imgfinder
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Images can have metadata about where and how they were taken, like EXIF
+// with GPS coordinates and camera serial numbers. Stripping removes it without
+// encoding the image again: the EXIF, XMP and IPTC segments of JPEGs and the
+// text and EXIF chunks of PNGs.
+
+const (
+	jpegAPP1  = 0xe1
+	jpegAPP13 = 0xed
+	// exifGPSTag is the tag of the IFD0 entry pointing to the GPS data
+	exifGPSTag = 0x8825
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	iptcHeader = []byte("Photoshop 3.0\x00")
+)
+
+// stripMetadata returns an image of the content type without its metadata,
+// and whether it had location data. GIFs have no metadata to strip.
+func stripMetadata(data []byte, contentType string) ([]byte, bool, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEGMetadata(data)
+	case "image/png":
+		return stripPNGMetadata(data)
+	}
+
+	return data, false, nil
+}
+
+func stripJPEGMetadata(data []byte) ([]byte, bool, error) {
+	stripped := append([]byte(nil), jpegSOI...)
+	location := false
+
+	offset := len(jpegSOI)
+	for {
+		marker, length, err := jpegSegment(data, offset)
+		if err != nil {
+			return nil, false, err
+		}
+
+		// Metadata segments are all before the image data
+		if marker == jpegSOS {
+			return append(stripped, data[offset:]...), location, nil
+		}
+
+		payload := data[offset+4 : offset+2+length]
+		switch {
+		case marker == jpegAPP1 && bytes.HasPrefix(payload, exifHeader):
+			location = location || exifHasLocation(payload[len(exifHeader):])
+		case marker == jpegAPP1 && bytes.HasPrefix(payload, xmpHeader):
+			location = location || xmpHasLocation(payload)
+		case marker == jpegAPP13 && bytes.HasPrefix(payload, iptcHeader):
+		default:
+			// Other segments, like the color profile, are needed to display
+			// the image as it is
+			stripped = append(stripped, data[offset:offset+2+length]...)
+		}
+
+		offset += 2 + length
+	}
+}
+
+func stripPNGMetadata(data []byte) ([]byte, bool, error) {
+	stripped := append([]byte(nil), pngSignature...)
+	location := false
+
+	offset := len(pngSignature)
+	for offset < len(data) {
+		chunkType, length, err := pngChunk(data, offset)
+		if err != nil {
+			return nil, false, err
+		}
+
+		chunkData := data[offset+8 : offset+8+length]
+		switch chunkType {
+		case "eXIf":
+			location = location || exifHasLocation(chunkData)
+		case "tEXt", "zTXt", "iTXt":
+			// XMP is in an iTXt chunk
+			location = location || xmpHasLocation(chunkData)
+		default:
+			stripped = append(stripped, data[offset:offset+12+length]...)
+		}
+
+		offset += 12 + length
+		if chunkType == "IEND" {
+			break
+		}
+	}
+
+	return stripped, location, nil
+}
+
+// exifHasLocation is whether EXIF data, a TIFF header with IFDs, points to GPS
+// data
+func exifHasLocation(exif []byte) bool {
+	if len(exif) < 8 {
+		return false
+	}
+
+	var order binary.ByteOrder
+	switch string(exif[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return false
+	}
+
+	ifd := int(order.Uint32(exif[4:]))
+	if ifd < 8 || ifd+2 > len(exif) {
+		return false
+	}
+
+	entries := int(order.Uint16(exif[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(exif) {
+			return false
+		}
+
+		if order.Uint16(exif[entry:]) == exifGPSTag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// xmpHasLocation is whether XMP data has GPS coordinates
+func xmpHasLocation(xmp []byte) bool {
+	return bytes.Contains(xmp, []byte("GPSLatitude")) || bytes.Contains(xmp, []byte("GPSLongitude"))
+}
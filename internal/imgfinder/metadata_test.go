@@ -0,0 +1,139 @@
+package imgfinder_test
+
+import (
+	"bytes"
+	"cat-scraper/internal/imgfinder"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exifWithGPS is little endian EXIF data whose IFD0 only points to GPS data
+func exifWithGPS() []byte {
+	exif := []byte("II*\x00\x08\x00\x00\x00")
+	exif = append(exif, 1, 0)
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry, 0x8825)
+	binary.LittleEndian.PutUint16(entry[2:], 4)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint32(entry[8:], 26)
+	exif = append(exif, entry...)
+
+	return append(exif, 0, 0, 0, 0)
+}
+
+// withJPEGSegments inserts segments after the SOI marker of a JPEG
+func withJPEGSegments(data []byte, segments ...[]byte) []byte {
+	result := append([]byte(nil), data[:2]...)
+	for _, segment := range segments {
+		result = append(result, segment...)
+	}
+
+	return append(result, data[2:]...)
+}
+
+func jpegSegment(marker byte, payload string) []byte {
+	segment := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+
+	return append(segment, payload...)
+}
+
+// withPNGChunks inserts chunks after the IHDR chunk of a PNG
+func withPNGChunks(data []byte, chunks ...[]byte) []byte {
+	result := append([]byte(nil), data[:33]...)
+	for _, chunk := range chunks {
+		result = append(result, chunk...)
+	}
+
+	return append(result, data[33:]...)
+}
+
+func pngChunk(chunkType string, data string) []byte {
+	chunk := make([]byte, 4)
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, data...)
+
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE(chunk[4:]))
+
+	return append(chunk, crc...)
+}
+
+func TestStripsJPEGMetadata(t *testing.T) {
+	var original bytes.Buffer
+	require.NoError(t, jpeg.Encode(&original, image.NewRGBA(image.Rect(0, 0, 40, 20)), nil))
+
+	withMetadata := withJPEGSegments(original.Bytes(),
+		jpegSegment(0xe1, "Exif\x00\x00"+string(exifWithGPS())),
+		jpegSegment(0xe1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"),
+		jpegSegment(0xed, "Photoshop 3.0\x008BIM"),
+		jpegSegment(0xe2, "ICC_PROFILE\x00"),
+	)
+
+	finder, writer := newThumbnailFinder(withMetadata, "image/jpeg")
+	var log bytes.Buffer
+	var events []imgfinder.Event
+	finder = finder.WithStripMetadata(true).WithManifest(true).WithLog(&log).WithObserver(recordingObserver{events: &events})
+
+	require.NoError(t, finder.CollectAndDownloadImages(1, 1, "images/"))
+
+	// Only the color profile is kept
+	assert.Equal(t, withJPEGSegments(original.Bytes(), jpegSegment(0xe2, "ICC_PROFILE\x00")), writer.Files()["images/1.jpg"])
+	assert.Contains(t, log.String(), "Removed location data from images/1.jpg\n")
+
+	require.Len(t, events, 1)
+	assert.True(t, events[0].LocationRemoved)
+
+	manifest, err := imgfinder.ReadManifest(writer, "images")
+	require.NoError(t, err)
+	require.Len(t, manifest.Images, 1)
+	assert.True(t, manifest.Images[0].LocationRemoved)
+}
+
+func TestStripsPNGMetadata(t *testing.T) {
+	original := encodedPNG(t, 40, 20)
+
+	withMetadata := withPNGChunks(original,
+		pngChunk("tEXt", "Author\x00Someone"),
+		pngChunk("iTXt", "XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"),
+		pngChunk("pHYs", "\x00\x00\x0b\x13\x00\x00\x0b\x13\x01"),
+	)
+
+	finder, writer := newThumbnailFinder(withMetadata, "image/png")
+	var log bytes.Buffer
+	finder = finder.WithStripMetadata(true).WithManifest(true).WithLog(&log)
+
+	require.NoError(t, finder.CollectAndDownloadImages(1, 1, "images/"))
+
+	assert.Equal(t, withPNGChunks(original, pngChunk("pHYs", "\x00\x00\x0b\x13\x00\x00\x0b\x13\x01")), writer.Files()["images/1.png"])
+	assert.NotContains(t, log.String(), "location")
+	require.Contains(t, writer.Files(), "images/manifest.json")
+	assert.NotContains(t, string(writer.Files()["images/manifest.json"]), "location_removed")
+}
+
+func TestReportsPNGLocation(t *testing.T) {
+	finder, writer := newThumbnailFinder(withPNGChunks(encodedPNG(t, 40, 20), pngChunk("eXIf", string(exifWithGPS()))), "image/png")
+	var log bytes.Buffer
+	finder = finder.WithStripMetadata(true).WithLog(&log)
+
+	require.NoError(t, finder.CollectAndDownloadImages(1, 1, "images/"))
+
+	assert.Equal(t, encodedPNG(t, 40, 20), writer.Files()["images/1.png"])
+	assert.Contains(t, log.String(), "Removed location data from images/1.png\n")
+}
+
+func TestKeepsMetadataWithoutStripping(t *testing.T) {
+	withMetadata := withPNGChunks(encodedPNG(t, 40, 20), pngChunk("eXIf", string(exifWithGPS())))
+
+	finder, writer := newThumbnailFinder(withMetadata, "image/png")
+	require.NoError(t, finder.WithLog(&bytes.Buffer{}).CollectAndDownloadImages(1, 1, "images/"))
+
+	assert.Equal(t, withMetadata, writer.Files()["images/1.png"])
+}
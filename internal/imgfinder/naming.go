@@ -0,0 +1,194 @@
+package imgfinder
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// DefaultNameTemplate names images by their position, e.g. 1.jpg, 2.png
+const DefaultNameTemplate = "{{.Index}}{{.Ext}}"
+
+// maxNameLength is the maximum length in bytes of each element of a saved
+// image path. Most file systems allow 255, but leave some room for suffixes.
+const maxNameLength = 120
+
+// NameData are the fields available to name templates
+type NameData struct {
+	// Index is the position of the image, starting from 1
+	Index int
+	ID1   string
+	ID2   string
+	Slug  string
+	Title string
+	// Date is when the image was downloaded, formatted as 2006-01-02
+	Date string
+	Site string
+	// Ext is the extension of the file, including the leading dot
+	Ext string
+}
+
+// A Namer names saved images from a text/template. Names are sanitized into
+// safe file names, and may contain / to save images into subdirectories.
+type Namer struct {
+	template *template.Template
+}
+
+var nameFuncs = template.FuncMap{
+	// pad zero-pads a number to the given width, e.g. {{pad 3 .Index}}
+	"pad": func(width int, n int) string {
+		return fmt.Sprintf("%0*d", width, n)
+	},
+	"lower": strings.ToLower,
+}
+
+func NewNamer(text string) (Namer, error) {
+	tmpl, err := template.New("name").Funcs(nameFuncs).Parse(text)
+	if err != nil {
+		return Namer{}, fmt.Errorf("parsing name template: %s", err)
+	}
+
+	return Namer{template: tmpl}, nil
+}
+
+// Name renders the template for an image. The result always ends with the
+// image extension.
+func (n Namer) Name(data NameData) (string, error) {
+	var rendered strings.Builder
+	err := n.template.Execute(&rendered, data)
+	if err != nil {
+		return "", fmt.Errorf("rendering name template: %s", err)
+	}
+
+	name := strings.TrimSuffix(rendered.String(), data.Ext)
+
+	var elements []string
+	for _, element := range strings.Split(name, "/") {
+		if sanitized := sanitizeNameElement(element); sanitized != "" {
+			elements = append(elements, sanitized)
+		}
+	}
+
+	if len(elements) == 0 {
+		elements = []string{strconv.Itoa(data.Index)}
+	}
+
+	last := len(elements) - 1
+	elements[last] = truncate(elements[last], maxNameLength-len(data.Ext)) + data.Ext
+
+	return filepath.Join(elements...), nil
+}
+
+// transliterations has replacements for letters that don't decompose into an
+// ASCII letter and a combining mark
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+	'đ': "d", 'Đ': "D", 'ð': "d", 'Ð': "D", 'þ': "th", 'Þ': "TH", 'ł': "l", 'Ł': "L",
+}
+
+// sanitizeNameElement turns an element of a path into a safe file name. Accents
+// are removed, and everything that's not an ASCII letter, number, dot,
+// underscore or dash is replaced by a dash.
+func sanitizeNameElement(element string) string {
+	var sanitized strings.Builder
+	lastWasDash := false
+
+	writeDash := func() {
+		if !lastWasDash {
+			sanitized.WriteByte('-')
+			lastWasDash = true
+		}
+	}
+
+	// Decompose so accented letters become a letter and a combining mark,
+	// which is dropped.
+	for _, r := range norm.NFD.String(element) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			continue
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-'):
+			sanitized.WriteRune(r)
+			lastWasDash = r == '-'
+		case transliterations[r] != "":
+			sanitized.WriteString(transliterations[r])
+			lastWasDash = false
+		default:
+			writeDash()
+		}
+	}
+
+	// Leading dots would make hidden files (or . and ..)
+	return strings.Trim(sanitized.String(), "-.")
+}
+
+func truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+
+	return strings.TrimRight(s[:length], "-.")
+}
+
+// pathReservations makes sure two images are never saved to the same path. It
+// is safe for concurrent use.
+type pathReservations struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+func newPathReservations() *pathReservations {
+	return &pathReservations{paths: map[string]bool{}}
+}
+
+// reserve returns path if it wasn't reserved before, or adds a -2, -3, ...
+// suffix until it finds one that wasn't. Paths are compared ignoring case so
+// they are also unique in case-insensitive file systems.
+//
+// If taken is not nil, paths for which it returns true are skipped too. It's
+// called while holding the lock, so it gets a function to check reservations.
+func (r *pathReservations) reserve(path string, taken func(path string, isReserved func(string) bool) (bool, error)) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+
+	candidate := path
+	for i := 2; ; i++ {
+		available := !r.paths[strings.ToLower(candidate)]
+		if available && taken != nil {
+			isTaken, err := taken(candidate, r.isReservedLocked)
+			if err != nil {
+				return "", err
+			}
+			available = !isTaken
+		}
+
+		if available {
+			break
+		}
+
+		candidate = fmt.Sprintf("%s-%d%s", stem, i, ext)
+	}
+
+	r.paths[strings.ToLower(candidate)] = true
+	return candidate, nil
+}
+
+// isReserved returns whether path was reserved
+func (r *pathReservations) isReserved(path string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.isReservedLocked(path)
+}
+
+func (r *pathReservations) isReservedLocked(path string) bool {
+	return r.paths[strings.ToLower(path)]
+}
@@ -0,0 +1,67 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/internal/imgfinder"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamerTemplates(t *testing.T) {
+	data := imgfinder.NameData{
+		Index: 7,
+		ID1:   "9732390400",
+		ID2:   "h07F891DD",
+		Slug:  "burn",
+		Title: "Crème brûlée, straße & Łódź: a cat's tale?",
+		Date:  "2023-02-03",
+		Site:  "icanhas",
+		Ext:   ".jpg",
+	}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{imgfinder.DefaultNameTemplate, "7.jpg"},
+		{"{{pad 3 .Index}}-{{.Slug}}{{.Ext}}", "007-burn.jpg"},
+		{`{{printf "%04d" .Index}}`, "0007.jpg"}, // extension is added when missing
+		{"{{.Site}}/{{.Date}}/{{.ID1}}-{{.ID2}}", "icanhas/2023-02-03/9732390400-h07F891DD.jpg"},
+		{"{{lower .Title}}", "creme-brulee-strasse-lodz-a-cat-s-tale.jpg"},
+		{"../../{{.Slug}}", "burn.jpg"},                   // can't escape the images directory
+		{"{{.Index}}/../.hidden{{.Ext}}", "7/hidden.jpg"}, // no dot files
+		{"😺", "7.jpg"}, // falls back to the index when nothing is left
+	}
+
+	for _, test := range tests {
+		namer, err := imgfinder.NewNamer(test.template)
+		require.NoError(t, err)
+
+		name, err := namer.Name(data)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, name, test.template)
+	}
+}
+
+func TestNamerLimitsLength(t *testing.T) {
+	namer, err := imgfinder.NewNamer("{{.Slug}}")
+	require.NoError(t, err)
+
+	name, err := namer.Name(imgfinder.NameData{Slug: strings.Repeat("a", 300), Ext: ".png"})
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", 116)+".png", name)
+}
+
+func TestNamerInvalidTemplates(t *testing.T) {
+	_, err := imgfinder.NewNamer("{{.Index")
+	require.EqualError(t, err, "parsing name template: template: name:1: unclosed action")
+
+	namer, err := imgfinder.NewNamer("{{.Unknown}}")
+	require.NoError(t, err)
+
+	_, err = namer.Name(imgfinder.NameData{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rendering name template")
+}
@@ -0,0 +1,41 @@
+package imgfinder
+
+// EventKind is what happened to an image of a download
+type EventKind string
+
+const (
+	// EventSaved is an image that was saved
+	EventSaved EventKind = "saved"
+	// EventSkipped is an image that wasn't saved, because it was rejected by
+	// the filter or it already exists
+	EventSkipped EventKind = "skipped"
+	// EventFailed is an image that couldn't be downloaded or saved
+	EventFailed EventKind = "failed"
+)
+
+// An Event is what happened to an image of a download
+type Event struct {
+	Kind  EventKind
+	Image Image
+	// Path of the saved image relative to the images directory, with /
+	// separators, and its size in bytes
+	Path string
+	Size int
+	// LocationRemoved is whether location data was stripped from the saved
+	// image
+	LocationRemoved bool
+	// Err is why the image was skipped or failed
+	Err error
+}
+
+// An Observer is told what happens to every image of a download. Events are
+// observed one at a time, as the downloads finish.
+type Observer interface {
+	Observe(event Event)
+}
+
+func (f Finder) observe(event Event) {
+	if f.observer != nil {
+		f.observer.Observe(event)
+	}
+}
@@ -0,0 +1,56 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingObserver struct {
+	events *[]imgfinder.Event
+}
+
+func (o recordingObserver) Observe(event imgfinder.Event) {
+	*o.events = append(*o.events, event)
+}
+
+func TestObservesDownloadsAndKeepsGoing(t *testing.T) {
+	const url = "https://i.chzbgr.com/full/1/h6860EF7A"
+	const brokenURL = "https://i.chzbgr.com/full/2/h6860EF7A"
+	content := []byte("hello")
+
+	scrapper := MockScrapper{
+		URLsByPage: map[string][]string{
+			"https://icanhas.cheezburger.com/": {url, brokenURL},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle(url, catscrapertest.Response{Content: content, ContentType: "image/jpeg", StatusCode: http.StatusOK})
+	getter.Handle(brokenURL, catscrapertest.Response{ContentType: "image/jpeg", StatusCode: http.StatusInternalServerError})
+	writer := catscrapertest.NewFileSystem()
+
+	var events []imgfinder.Event
+	finder := imgfinder.New(scrapper, writer, getter).
+		WithObserver(recordingObserver{events: &events}).
+		WithKeepGoing(true).
+		WithManifest(false)
+
+	err := finder.CollectAndDownloadImages(2, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{"images/1.jpg": content}, writer.Files())
+	require.Len(t, events, 2)
+
+	assert.Equal(t, imgfinder.EventSaved, events[0].Kind)
+	assert.Equal(t, "1.jpg", events[0].Path)
+	assert.Equal(t, len(content), events[0].Size)
+
+	assert.Equal(t, imgfinder.EventFailed, events[1].Kind)
+	assert.Equal(t, brokenURL, events[1].Image.URL)
+	assert.Error(t, events[1].Err)
+}
@@ -0,0 +1,70 @@
+package imgfinder
+
+import (
+	"fmt"
+	"time"
+)
+
+// A PlannedImage is an image that would be downloaded
+type PlannedImage struct {
+	Image
+	// Index is the position the image would be saved with, starting from 1
+	Index int
+	// Path is where the image would be saved, relative to the images
+	// directory. It only has an extension if images are converted, as
+	// otherwise it depends on the content type they are downloaded as.
+	Path string
+}
+
+// PlanImages returns the images CollectAndDownloadFromSites would download and
+// where they would be saved, without downloading them or touching the file
+// system. Images rejected after downloading them, for example because of their
+// file size, can't be known, and neither can conflicts with the images
+// already saved. Numbering always starts from 1, as continuing it needs the
+// file system.
+func (f Finder) PlanImages(quotas []SiteQuota) ([]PlannedImage, error) {
+	images, err := f.CollectImages(quotas)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.PlanDownload(images)
+}
+
+// PlanDownload returns where DownloadImages would save images, with the same
+// limits as PlanImages
+func (f Finder) PlanDownload(images []Image) ([]PlannedImage, error) {
+	saver := imageSaver{date: time.Now().Format("2006-01-02"), reservations: newPathReservations()}
+
+	var planned []PlannedImage
+	for i, image := range images {
+		request := imageRequest{collectedImage: collectedImage{image: image}, index: i + 1}
+
+		name, err := f.namer.Name(f.nameData(request, f.plannedExtension(), saver))
+		if err != nil {
+			return nil, fmt.Errorf("naming %s: %s", image.URL, err)
+		}
+
+		// Images named the same are saved with a suffix, like when downloading
+		path, err := saver.reservations.reserve(name, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		planned = append(planned, PlannedImage{Image: image, Index: request.index, Path: path})
+	}
+
+	return planned, nil
+}
+
+// plannedExtension returns the extension an image would be saved with, or ""
+// if it depends on how it's downloaded
+func (f Finder) plannedExtension() string {
+	// Animated GIFs are kept, and which are animated is only known after
+	// downloading them
+	if f.conversion.ContentType == "" || f.conversion.GIF == GIFKeepAnimated {
+		return ""
+	}
+
+	return contentTypeToExt[f.conversion.ContentType]
+}
@@ -0,0 +1,45 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlansTheNamesImagesAreSavedWith(t *testing.T) {
+	images := []imgfinder.Image{
+		{URL: "https://i.chzbgr.com/full/1/a", Title: "Burn"},
+		{URL: "https://i.chzbgr.com/full/2/b", Title: "Burn"},
+		{URL: "https://i.chzbgr.com/full/3/c", Title: "burn"},
+	}
+
+	namer, err := imgfinder.NewNamer("{{.Title}}{{.Ext}}")
+	require.NoError(t, err)
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle("", catscrapertest.Response{Content: []byte("meme"), ContentType: "image/jpeg"})
+	writer := catscrapertest.NewFileSystem()
+	finder := imgfinder.New(MockScrapper{}, writer, getter).WithNamer(namer).WithManifest(false)
+
+	planned, err := finder.PlanDownload(images)
+	require.NoError(t, err)
+
+	var paths []string
+	for _, image := range planned {
+		paths = append(paths, image.Path)
+	}
+	assert.Equal(t, []string{"Burn", "Burn-2", "burn-3"}, paths)
+
+	// Downloading saves them where planned, with the extension of their
+	// content type
+	err = finder.DownloadImages(images, 1, "images")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		"images/Burn.jpg":   []byte("meme"),
+		"images/Burn-2.jpg": []byte("meme"),
+		"images/burn-3.jpg": []byte("meme"),
+	}, writer.Files())
+}
@@ -0,0 +1,390 @@
+package imgfinder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// Provenance is where a saved image comes from. It's embedded in the image
+// file, so it isn't lost when the image is shared without its manifest: in a
+// comment segment of JPEGs, an iTXt chunk of PNGs and a comment extension of
+// GIFs. The pixel data isn't touched.
+type Provenance struct {
+	// SourceURL is where the image was downloaded from
+	SourceURL    string    `json:"source_url"`
+	Title        string    `json:"title,omitempty"`
+	Site         string    `json:"site,omitempty"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+}
+
+// provenanceKeyword identifies the provenance among other comments and text
+// chunks
+const provenanceKeyword = "cat-scraper-provenance"
+
+// ErrNoProvenance is returned when reading the provenance of an image that
+// doesn't have one
+var ErrNoProvenance = errors.New("no provenance in the image")
+
+var (
+	jpegSOI      = []byte{0xff, 0xd8}
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// ReadProvenance reads the provenance embedded in an image file
+func (f Finder) ReadProvenance(name string) (Provenance, error) {
+	data, err := f.fileSystem.ReadFile(name)
+	if err != nil {
+		return Provenance{}, err
+	}
+
+	return ReadProvenance(data)
+}
+
+// ReadProvenance reads the provenance embedded in an image
+func ReadProvenance(data []byte) (Provenance, error) {
+	var text []byte
+	var err error
+
+	switch {
+	case bytes.HasPrefix(data, jpegSOI):
+		text, err = jpegProvenance(data)
+	case bytes.HasPrefix(data, pngSignature):
+		text, err = pngProvenance(data)
+	case bytes.HasPrefix(data, []byte("GIF8")):
+		text, err = gifProvenance(data)
+	default:
+		return Provenance{}, fmt.Errorf("unexpected image format, expected jpeg, png or gif")
+	}
+
+	if err != nil {
+		return Provenance{}, err
+	}
+
+	if text == nil {
+		return Provenance{}, ErrNoProvenance
+	}
+
+	var provenance Provenance
+	err = json.Unmarshal(text, &provenance)
+	if err != nil {
+		return Provenance{}, fmt.Errorf("parsing provenance: %s", err)
+	}
+
+	return provenance, nil
+}
+
+// embedProvenance returns an image of the content type with the provenance
+// embedded
+func embedProvenance(data []byte, contentType string, provenance Provenance) ([]byte, error) {
+	text, err := json.Marshal(provenance)
+	if err != nil {
+		return nil, err
+	}
+
+	switch contentType {
+	case "image/jpeg":
+		return embedJPEGProvenance(data, text)
+	case "image/png":
+		return embedPNGProvenance(data, text)
+	case "image/gif":
+		return embedGIFProvenance(data, text)
+	}
+
+	return nil, fmt.Errorf("unexpected content type '%s'", contentType)
+}
+
+// JPEGs are segments of a 0xff byte, a marker byte and, except for a few
+// markers, a two bytes big endian length that includes itself. The comment goes
+// after the APPn segments, which must be first, like the JFIF one.
+
+const (
+	jpegCOM = 0xfe
+	jpegSOS = 0xda
+)
+
+func embedJPEGProvenance(data []byte, text []byte) ([]byte, error) {
+	payload := append([]byte(provenanceKeyword+"\n"), text...)
+	if len(payload)+2 > 0xffff {
+		return nil, fmt.Errorf("provenance of %d bytes doesn't fit in a jpeg comment", len(payload))
+	}
+
+	offset, err := jpegAfterAPPSegments(data)
+	if err != nil {
+		return nil, err
+	}
+
+	segment := []byte{0xff, jpegCOM, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	return insertBytes(data, offset, segment), nil
+}
+
+// jpegAfterAPPSegments returns the offset after the APPn segments of a JPEG
+func jpegAfterAPPSegments(data []byte) (int, error) {
+	offset := len(jpegSOI)
+	for {
+		marker, length, err := jpegSegment(data, offset)
+		if err != nil {
+			return 0, err
+		}
+
+		if marker < 0xe0 || marker > 0xef {
+			return offset, nil
+		}
+
+		offset += 2 + length
+	}
+}
+
+func jpegProvenance(data []byte) ([]byte, error) {
+	offset := len(jpegSOI)
+	for {
+		marker, length, err := jpegSegment(data, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		// Metadata segments are all before the image data
+		if marker == jpegSOS {
+			return nil, nil
+		}
+
+		payload := data[offset+4 : offset+2+length]
+		if marker == jpegCOM && bytes.HasPrefix(payload, []byte(provenanceKeyword+"\n")) {
+			return payload[len(provenanceKeyword)+1:], nil
+		}
+
+		offset += 2 + length
+	}
+}
+
+// jpegSegment returns the marker and length of the segment at offset
+func jpegSegment(data []byte, offset int) (byte, int, error) {
+	if offset+4 > len(data) || data[offset] != 0xff {
+		return 0, 0, fmt.Errorf("invalid jpeg segment at %d", offset)
+	}
+
+	length := int(binary.BigEndian.Uint16(data[offset+2:]))
+	if length < 2 || offset+2+length > len(data) {
+		return 0, 0, fmt.Errorf("invalid jpeg segment length at %d", offset)
+	}
+
+	return data[offset+1], length, nil
+}
+
+// PNGs are the signature and chunks of a four bytes big endian length, a type,
+// the data and a CRC of the type and data. The iTXt chunk goes right after
+// the IHDR chunk, which must be first.
+
+func embedPNGProvenance(data []byte, text []byte) ([]byte, error) {
+	// Keyword, no compression, and empty language and translated keyword
+	chunkData := append([]byte(provenanceKeyword+"\x00\x00\x00\x00\x00"), text...)
+
+	offset := len(pngSignature)
+	chunkType, length, err := pngChunk(data, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if chunkType != "IHDR" {
+		return nil, fmt.Errorf("invalid png, expected IHDR as the first chunk")
+	}
+	offset += 12 + length
+
+	chunk := make([]byte, 8, 12+len(chunkData))
+	binary.BigEndian.PutUint32(chunk, uint32(len(chunkData)))
+	copy(chunk[4:], "iTXt")
+	chunk = append(chunk, chunkData...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(chunk[4:len(chunk)-4]))
+
+	return insertBytes(data, offset, chunk), nil
+}
+
+func pngProvenance(data []byte) ([]byte, error) {
+	prefix := []byte(provenanceKeyword + "\x00\x00\x00\x00\x00")
+
+	offset := len(pngSignature)
+	for offset < len(data) {
+		chunkType, length, err := pngChunk(data, offset)
+		if err != nil {
+			return nil, err
+		}
+
+		chunkData := data[offset+8 : offset+8+length]
+		if chunkType == "iTXt" && bytes.HasPrefix(chunkData, prefix) {
+			return chunkData[len(prefix):], nil
+		}
+
+		if chunkType == "IEND" {
+			break
+		}
+
+		offset += 12 + length
+	}
+
+	return nil, nil
+}
+
+// pngChunk returns the type and data length of the chunk at offset
+func pngChunk(data []byte, offset int) (string, int, error) {
+	if offset+12 > len(data) {
+		return "", 0, fmt.Errorf("invalid png chunk at %d", offset)
+	}
+
+	length := int(binary.BigEndian.Uint32(data[offset:]))
+	if length < 0 || offset+12+length > len(data) {
+		return "", 0, fmt.Errorf("invalid png chunk length at %d", offset)
+	}
+
+	return string(data[offset+4 : offset+8]), length, nil
+}
+
+// GIFs are a header, the logical screen descriptor with an optional global
+// color table, and blocks: extensions, images and the trailer. Extensions and
+// image data are sub-blocks of up to 255 bytes, each after its length, ending
+// with an empty one. The comment extension goes before the first block.
+
+const (
+	gifExtension    = 0x21
+	gifImage        = 0x2c
+	gifTrailer      = 0x3b
+	gifCommentLabel = 0xfe
+	// gifScreenSize is the size of the header and logical screen descriptor
+	gifScreenSize = 13
+	// gifImageDescriptorSize is the size of an image descriptor, with its
+	// separator
+	gifImageDescriptorSize = 10
+)
+
+func embedGIFProvenance(data []byte, text []byte) ([]byte, error) {
+	offset, err := gifFirstBlock(data)
+	if err != nil {
+		return nil, err
+	}
+
+	extension := []byte{gifExtension, gifCommentLabel}
+	payload := append([]byte(provenanceKeyword+"\n"), text...)
+	for len(payload) > 0 {
+		size := len(payload)
+		if size > 255 {
+			size = 255
+		}
+
+		extension = append(extension, byte(size))
+		extension = append(extension, payload[:size]...)
+		payload = payload[size:]
+	}
+	extension = append(extension, 0)
+
+	return insertBytes(data, offset, extension), nil
+}
+
+func gifProvenance(data []byte) ([]byte, error) {
+	offset, err := gifFirstBlock(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for offset < len(data) {
+		switch data[offset] {
+		case gifTrailer:
+			return nil, nil
+		case gifExtension:
+			if offset+2 > len(data) {
+				return nil, fmt.Errorf("invalid gif extension at %d", offset)
+			}
+
+			content, end, err := gifSubBlocks(data, offset+2)
+			if err != nil {
+				return nil, err
+			}
+
+			if data[offset+1] == gifCommentLabel && bytes.HasPrefix(content, []byte(provenanceKeyword+"\n")) {
+				return content[len(provenanceKeyword)+1:], nil
+			}
+
+			offset = end
+		case gifImage:
+			if offset+gifImageDescriptorSize+1 > len(data) {
+				return nil, fmt.Errorf("invalid gif image at %d", offset)
+			}
+
+			// The descriptor, the local color table and the LZW minimum
+			// code size come before the image data
+			offset += gifImageDescriptorSize + gifColorTableSize(data[offset+9]) + 1
+
+			_, offset, err = gifSubBlocks(data, offset)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("invalid gif block at %d", offset)
+		}
+	}
+
+	return nil, nil
+}
+
+// gifFirstBlock returns the offset of the first block of a GIF
+func gifFirstBlock(data []byte) (int, error) {
+	if len(data) < gifScreenSize {
+		return 0, fmt.Errorf("invalid gif, too short")
+	}
+
+	offset := gifScreenSize + gifColorTableSize(data[10])
+	if offset > len(data) {
+		return 0, fmt.Errorf("invalid gif, too short")
+	}
+
+	return offset, nil
+}
+
+// gifColorTableSize returns the size of the color table of the packed fields
+// of a logical screen or image descriptor
+func gifColorTableSize(packed byte) int {
+	if packed&0x80 == 0 {
+		return 0
+	}
+
+	return 3 * (1 << ((packed & 0x07) + 1))
+}
+
+// gifSubBlocks returns the content of the sub-blocks at offset and the offset
+// after them
+func gifSubBlocks(data []byte, offset int) ([]byte, int, error) {
+	var content []byte
+	for {
+		if offset >= len(data) {
+			return nil, 0, fmt.Errorf("invalid gif sub-block at %d", offset)
+		}
+
+		size := int(data[offset])
+		offset++
+		if size == 0 {
+			return content, offset, nil
+		}
+
+		if offset+size > len(data) {
+			return nil, 0, fmt.Errorf("invalid gif sub-block at %d", offset)
+		}
+
+		content = append(content, data[offset:offset+size]...)
+		offset += size
+	}
+}
+
+// insertBytes returns data with inserted at offset
+func insertBytes(data []byte, offset int, inserted []byte) []byte {
+	result := make([]byte, 0, len(data)+len(inserted))
+	result = append(result, data[:offset]...)
+	result = append(result, inserted...)
+
+	return append(result, data[offset:]...)
+}
@@ -0,0 +1,93 @@
+package imgfinder_test
+
+import (
+	"bytes"
+	"cat-scraper/internal/imgfinder"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedsProvenanceWithoutChangingPixels(t *testing.T) {
+	var encodedJPEG bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encodedJPEG, image.NewRGBA(image.Rect(0, 0, 40, 20)), nil))
+
+	tests := []struct {
+		name        string
+		content     []byte
+		contentType string
+		path        string
+	}{
+		{name: "jpeg", content: encodedJPEG.Bytes(), contentType: "image/jpeg", path: "images/1.jpg"},
+		{name: "png", content: encodedPNG(t, 40, 20), contentType: "image/png", path: "images/1.png"},
+		{name: "gif", content: animatedGIF(t, 40, 20, 3), contentType: "image/gif", path: "images/1.gif"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			finder, writer := newThumbnailFinder(test.content, test.contentType)
+			finder = finder.WithProvenance(true).WithSite(imgfinder.Site{Name: "icanhas", BaseURL: "https://icanhas.cheezburger.com/"})
+
+			start := time.Now()
+			require.NoError(t, finder.CollectAndDownloadImages(1, 1, "images/"))
+
+			saved := writer.Files()[test.path]
+			require.NotNil(t, saved)
+
+			provenance, err := finder.ReadProvenance(test.path)
+			require.NoError(t, err)
+			assert.Equal(t, "https://i.chzbgr.com/full/9730332160/h6860EF7A", provenance.SourceURL)
+			assert.Equal(t, "icanhas", provenance.Site)
+			assert.False(t, provenance.DownloadedAt.Before(start.Truncate(time.Second)))
+
+			// The metadata is added, but the pixels are the same
+			assert.NotEqual(t, test.content, saved)
+			if test.contentType == "image/gif" {
+				original, err := gif.DecodeAll(bytes.NewReader(test.content))
+				require.NoError(t, err)
+				embedded, err := gif.DecodeAll(bytes.NewReader(saved))
+				require.NoError(t, err)
+				assert.Equal(t, original.Image, embedded.Image)
+				return
+			}
+
+			original, _, err := image.Decode(bytes.NewReader(test.content))
+			require.NoError(t, err)
+			embedded, _, err := image.Decode(bytes.NewReader(saved))
+			require.NoError(t, err)
+			assert.Equal(t, original, embedded)
+		})
+	}
+}
+
+func TestReadsProvenanceOfLongTitles(t *testing.T) {
+	// GIF comments are split in blocks of 255 bytes
+	title := strings.Repeat("very long title ", 40)
+
+	finder, _ := newThumbnailFinder(animatedGIF(t, 10, 10, 1), "image/gif")
+	finder = finder.WithProvenance(true).WithScrapper(MockScrapper{
+		ImagesByPage: map[string][]imgfinder.Image{
+			"https://icanhas.cheezburger.com/": {{URL: "https://i.chzbgr.com/full/9730332160/h6860EF7A", Title: title}},
+		},
+	})
+
+	require.NoError(t, finder.CollectAndDownloadImages(1, 1, "images/"))
+
+	provenance, err := finder.ReadProvenance("images/1.gif")
+	require.NoError(t, err)
+	assert.Equal(t, title, provenance.Title)
+}
+
+func TestReadsMissingProvenance(t *testing.T) {
+	_, err := imgfinder.ReadProvenance(encodedPNG(t, 10, 10))
+	assert.Equal(t, imgfinder.ErrNoProvenance, err)
+
+	_, err = imgfinder.ReadProvenance([]byte("not an image"))
+	assert.EqualError(t, err, "unexpected image format, expected jpeg, png or gif")
+}
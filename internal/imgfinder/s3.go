@@ -0,0 +1,595 @@
+package imgfinder
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultS3PartSize is the size of the parts used for multipart uploads. Files
+// bigger than this are uploaded in parts. S3 requires every part but the last
+// to be at least 5 MiB.
+const DefaultS3PartSize = 8 << 20
+
+// S3FileSystem is a FileSystem that uploads files to a bucket of an
+// S3-compatible object storage. File names are used as object keys under
+// Prefix.
+//
+// Object storages don't have directories, so MkdirAll does nothing.
+type S3FileSystem struct {
+	// Endpoint is the base URL of the storage, e.g. https://s3.amazonaws.com.
+	// Buckets are addressed path-style ({endpoint}/{bucket}/{key}) because
+	// that's what most S3-compatible storages support.
+	Endpoint string
+	Region   string
+	Bucket   string
+	Prefix   string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// PartSize is the size of each part of a multipart upload. Zero means
+	// DefaultS3PartSize.
+	PartSize int
+
+	// Client makes the requests to the storage. Nil means http.DefaultClient,
+	// which never times out.
+	Client *http.Client
+}
+
+// NewS3FileSystem builds an S3FileSystem for a location with the format
+// s3://bucket/prefix. Credentials and endpoint are taken from the standard AWS
+// environment variables (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY,
+// AWS_SESSION_TOKEN, AWS_REGION and AWS_ENDPOINT_URL). Requests are made with
+// client.
+func NewS3FileSystem(location string, client *http.Client) (S3FileSystem, error) {
+	bucket, prefix, err := ParseS3Location(location)
+	if err != nil {
+		return S3FileSystem{}, err
+	}
+
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL")
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	return S3FileSystem{
+		Endpoint:        endpoint,
+		Region:          region,
+		Bucket:          bucket,
+		Prefix:          prefix,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Client:          client,
+	}, nil
+}
+
+// ParseS3Location splits an s3://bucket/prefix location into its bucket and
+// prefix.
+func ParseS3Location(location string) (bucket string, prefix string, err error) {
+	if !strings.HasPrefix(location, "s3://") {
+		return "", "", fmt.Errorf("invalid s3 location '%s', expected s3://bucket/prefix", location)
+	}
+
+	bucket, prefix, _ = strings.Cut(strings.TrimPrefix(location, "s3://"), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid s3 location '%s', missing bucket", location)
+	}
+
+	return bucket, strings.Trim(prefix, "/"), nil
+}
+
+func (fs S3FileSystem) WriteFile(name string, data []byte, _ os.FileMode) error {
+	key := fs.key(name)
+	contentType := contentTypeForFile(name)
+
+	if len(data) <= fs.partSize() {
+		return fs.putObject(key, data, contentType)
+	}
+
+	return fs.multipartUpload(key, data, contentType)
+}
+
+func (fs S3FileSystem) MkdirAll(_ string, _ os.FileMode) error {
+	return nil
+}
+
+func (fs S3FileSystem) ReadFile(name string) ([]byte, error) {
+	data, err := fs.do(http.MethodGet, fs.key(name), nil, nil, nil)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return data, nil
+}
+
+func (fs S3FileSystem) Stat(name string) (os.FileInfo, error) {
+	key := fs.key(name)
+
+	resp, err := fs.request(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, &iofs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	resp.Body.Close()
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+
+	return s3FileInfo{name: path.Base(key), size: resp.ContentLength, modTime: modTime}, nil
+}
+
+func (fs S3FileSystem) Exists(name string) (bool, error) {
+	return existsFromStat(fs, name)
+}
+
+func (fs S3FileSystem) Remove(name string) error {
+	_, err := fs.do(http.MethodDelete, fs.key(name), nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("removing %s: %s", fs.key(name), err)
+	}
+
+	return nil
+}
+
+// ReadDir lists the objects and common prefixes directly under name, as if /
+// separated directories.
+func (fs S3FileSystem) ReadDir(name string) ([]os.DirEntry, error) {
+	prefix := ""
+	if dir := fs.key(name); dir != "" && dir != "." {
+		prefix = dir + "/"
+	}
+
+	var entries []os.DirEntry
+	continuationToken := ""
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {prefix},
+			"delimiter": {"/"},
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		body, err := fs.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("listing %s: %s", prefix, err)
+		}
+
+		var result struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			CommonPrefixes []struct {
+				Prefix string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.Unmarshal(body, &result)
+		if err != nil {
+			return nil, fmt.Errorf("parsing listing of %s: %s", prefix, err)
+		}
+
+		for _, object := range result.Contents {
+			info := s3FileInfo{name: path.Base(object.Key), size: object.Size, modTime: object.LastModified}
+			entries = append(entries, iofs.FileInfoToDirEntry(info))
+		}
+
+		for _, commonPrefix := range result.CommonPrefixes {
+			info := s3FileInfo{name: path.Base(commonPrefix.Prefix), dir: true}
+			entries = append(entries, iofs.FileInfoToDirEntry(info))
+		}
+
+		if !result.IsTruncated {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+
+	// Same as os.ReadDir, there are no directories in object storages
+	if len(entries) == 0 {
+		return nil, &iofs.PathError{Op: "open", Path: name, Err: iofs.ErrNotExist}
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
+
+type s3FileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i s3FileInfo) Name() string       { return i.name }
+func (i s3FileInfo) Size() int64        { return i.size }
+func (i s3FileInfo) ModTime() time.Time { return i.modTime }
+func (i s3FileInfo) IsDir() bool        { return i.dir }
+func (i s3FileInfo) Sys() any           { return nil }
+
+func (i s3FileInfo) Mode() iofs.FileMode {
+	if i.dir {
+		return iofs.ModeDir | 0777
+	}
+
+	return 0666
+}
+
+func (fs S3FileSystem) key(name string) string {
+	return path.Join(fs.Prefix, filepath.ToSlash(name))
+}
+
+func (fs S3FileSystem) partSize() int {
+	if fs.PartSize <= 0 {
+		return DefaultS3PartSize
+	}
+
+	return fs.PartSize
+}
+
+func (fs S3FileSystem) putObject(key string, data []byte, contentType string) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+
+	_, err := fs.do(http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return fmt.Errorf("uploading %s: %s", key, err)
+	}
+
+	return nil
+}
+
+func (fs S3FileSystem) multipartUpload(key string, data []byte, contentType string) error {
+	uploadID, err := fs.createMultipartUpload(key, contentType)
+	if err != nil {
+		return fmt.Errorf("creating multipart upload for %s: %s", key, err)
+	}
+
+	parts, err := fs.uploadParts(key, uploadID, data)
+	if err == nil {
+		err = fs.completeMultipartUpload(key, uploadID, parts)
+	}
+
+	if err != nil {
+		// Abort so the storage doesn't keep the uploaded parts around. There's
+		// nothing else to do if aborting fails too.
+		_, _ = fs.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+		return fmt.Errorf("multipart upload of %s: %s", key, err)
+	}
+
+	return nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (fs S3FileSystem) createMultipartUpload(key string, contentType string) (string, error) {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+
+	body, err := fs.do(http.MethodPost, key, url.Values{"uploads": {""}}, header, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.Unmarshal(body, &result)
+	if err != nil {
+		return "", fmt.Errorf("parsing response: %s", err)
+	}
+
+	if result.UploadID == "" {
+		return "", errors.New("response has no upload id")
+	}
+
+	return result.UploadID, nil
+}
+
+func (fs S3FileSystem) uploadParts(key string, uploadID string, data []byte) ([]completedPart, error) {
+	var parts []completedPart
+	for start, number := 0, 1; start < len(data); start, number = start+fs.partSize(), number+1 {
+		end := start + fs.partSize()
+		if end > len(data) {
+			end = len(data)
+		}
+
+		query := url.Values{
+			"partNumber": {strconv.Itoa(number)},
+			"uploadId":   {uploadID},
+		}
+
+		resp, err := fs.request(http.MethodPut, key, query, nil, data[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("uploading part %d: %s", number, err)
+		}
+		resp.Body.Close()
+
+		parts = append(parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	}
+
+	return parts, nil
+}
+
+func (fs S3FileSystem) completeMultipartUpload(key string, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	_, err = fs.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return fmt.Errorf("completing: %s", err)
+	}
+
+	return nil
+}
+
+// do performs a signed request and returns the response body
+func (fs S3FileSystem) do(method string, key string, query url.Values, header http.Header, body []byte) ([]byte, error) {
+	resp, err := fs.request(method, key, query, header, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading body: %s", err)
+	}
+
+	return respBody, nil
+}
+
+// request performs a signed request, failing if the response isn't a 2xx.
+func (fs S3FileSystem) request(method string, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	req, _, err := fs.newSignedRequest(method, key, query, header, body, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	client := fs.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, s3ResponseError(resp)
+	}
+
+	return resp, nil
+}
+
+// s3Error is an error response from the storage. Not found errors wrap
+// fs.ErrNotExist.
+type s3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("unexpected status code '%d'", e.StatusCode)
+	}
+
+	return fmt.Sprintf("unexpected status code '%d': %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e s3Error) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return iofs.ErrNotExist
+	}
+
+	return nil
+}
+
+func s3ResponseError(resp *http.Response) error {
+	s3Err := s3Error{}
+
+	// HEAD responses have no body, so there may be only the status code
+	body, _ := io.ReadAll(resp.Body)
+	_ = xml.Unmarshal(body, &s3Err)
+	s3Err.StatusCode = resp.StatusCode
+
+	return s3Err
+}
+
+// newSignedRequest builds a request signed with AWS Signature Version 4
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (fs S3FileSystem) newSignedRequest(method string, key string, query url.Values, header http.Header, body []byte, now time.Time) (*http.Request, s3Signature, error) {
+	endpoint, err := url.Parse(fs.Endpoint)
+	if err != nil {
+		return nil, s3Signature{}, fmt.Errorf("parsing endpoint: %s", err)
+	}
+
+	canonicalURI := s3EscapePath(path.Join("/", endpoint.Path, fs.Bucket, key))
+	canonicalQuery := s3CanonicalQuery(query)
+
+	rawURL := fmt.Sprintf("%s://%s%s", endpoint.Scheme, endpoint.Host, canonicalURI)
+	if canonicalQuery != "" {
+		rawURL += "?" + canonicalQuery
+	}
+
+	req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, s3Signature{}, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", now.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if fs.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", fs.SessionToken)
+	}
+
+	signature := fs.sign(req, canonicalURI, canonicalQuery, payloadHash, now)
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		fs.AccessKeyID, signature.scope, signature.signedHeaders, signature.signature,
+	))
+
+	return req, signature, nil
+}
+
+// s3Signature is what's computed to sign a request
+type s3Signature struct {
+	canonicalRequest string
+	stringToSign     string
+	scope            string
+	signedHeaders    string
+	signature        string
+}
+
+// sign signs the host and every header of req
+func (fs S3FileSystem) sign(req *http.Request, canonicalURI string, canonicalQuery string, payloadHash string, now time.Time) s3Signature {
+	signed := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		signed[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+
+	var signedNames []string
+	for name := range signed {
+		signedNames = append(signedNames, name)
+	}
+	sort.Strings(signedNames)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signedNames {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, signed[name])
+	}
+
+	signature := s3Signature{signedHeaders: strings.Join(signedNames, ";")}
+	signature.canonicalRequest = strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		canonicalQuery,
+		canonicalHeaders.String(),
+		signature.signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	date := now.Format("20060102")
+	signature.scope = fmt.Sprintf("%s/%s/s3/aws4_request", date, fs.Region)
+	signature.stringToSign = strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format("20060102T150405Z"),
+		signature.scope,
+		sha256Hex([]byte(signature.canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+fs.SecretAccessKey), date)
+	for _, part := range []string{fs.Region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature.signature = hex.EncodeToString(hmacSHA256(signingKey, signature.stringToSign))
+
+	return signature
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath escapes every segment of the path with the URI encoding
+// expected by SigV4, which only leaves unreserved characters as they are.
+func s3EscapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(name)+"="+s3Escape(value))
+		}
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+func s3Escape(s string) string {
+	var escaped strings.Builder
+	for _, b := range []byte(s) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+
+	return escaped.String()
+}
+
+// contentTypeForFile picks the Content-Type of a saved file from its
+// extension, which was chosen by detectFileExtension when downloading.
+func contentTypeForFile(name string) string {
+	ext := filepath.Ext(name)
+	for contentType, imageExt := range contentTypeToExt {
+		if imageExt == ext {
+			return contentType
+		}
+	}
+
+	if ext == ".json" {
+		return "application/json"
+	}
+
+	return "application/octet-stream"
+}
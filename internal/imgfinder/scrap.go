@@ -3,24 +3,60 @@ package imgfinder
 import (
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gocolly/colly"
 )
 
-// CheezburgerScrapper scraps images from https://icanhas.cheezburger.com/
-// It may return the same images twice for different pages.
-type CheezburgerScrapper struct{}
+// CheezburgerScrapper scraps images from the sites of the Cheezburger network,
+// like https://icanhas.cheezburger.com/. It may return the same images twice
+// for different pages. Ads and sponsored content are left out.
+type CheezburgerScrapper struct {
+	// ImageHosts are the only hosts images are taken from. Empty means
+	// DefaultImageHosts.
+	ImageHosts []string
+	// Transport makes the requests for pages. Nil means
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// Timeout is how long a whole page request can take. Zero means the
+	// default of colly.
+	Timeout time.Duration
+	// Log is where the visited pages are reported. Nil means os.Stdout.
+	Log io.Writer
+}
+
+func (s CheezburgerScrapper) CollectImagesFrom(pageURL string) ([]Image, error) {
+	var images []Image
+	var err error
+
+	imageHosts := s.ImageHosts
+	if len(imageHosts) == 0 {
+		imageHosts = DefaultImageHosts
+	}
 
-func (s CheezburgerScrapper) CollectImageURLsFrom(pageURL string) ([]string, error) {
-	var imgURLs []string
+	log := s.Log
+	if log == nil {
+		log = os.Stdout
+	}
 
 	c := colly.NewCollector()
+	if s.Transport != nil {
+		c.WithTransport(s.Transport)
+	}
+
+	if s.Timeout != 0 {
+		c.SetRequestTimeout(s.Timeout)
+	}
 
 	// Before making a request print "Visiting ..."
 	c.OnRequest(func(r *colly.Request) {
-		fmt.Println("Visiting", r.URL.String())
+		fmt.Fprintln(log, "Visiting", r.URL.String())
 	})
 
 	// Select all img elements and save their source
@@ -35,41 +71,82 @@ func (s CheezburgerScrapper) CollectImageURLsFrom(pageURL string) ([]string, err
 
 		// Because the page lazy loads images and only loads them when they
 		// appear on the viewport, they start out with the src in `data-src`
-		// while `src` has a placeholder value (that's not an url starting
-		// with https)
+		// while `src` has a placeholder value (a data URL)
 		imgURL := e.Attr("src")
-		if !strings.HasPrefix(imgURL, "https") {
+		if imgURL == "" || strings.HasPrefix(imgURL, "data:") {
 			imgURL = e.Attr("data-src")
 		}
 
-		imgURLs = append(imgURLs, imgURL)
+		// Ad units may reuse the classes of memes, so they are also told
+		// apart by where they are and where they are served from
+		if !allowedHost(imgURL, imageHosts) || isSponsored(e.DOM) {
+			return
+		}
+
+		image, imgErr := newImage(imgURL)
+		if imgErr != nil {
+			// Keep the first error, the callback can't return it
+			if err == nil {
+				err = imgErr
+			}
+			return
+		}
+
+		image.Section = pageSection(e.DOM)
+		image.Title = strings.TrimSpace(e.Attr("title"))
+		image.Alt = strings.TrimSpace(e.Attr("alt"))
+
+		// Invalid or missing dimensions are left as unknown
+		image.Width, _ = strconv.Atoi(e.Attr("width"))
+		image.Height, _ = strconv.Atoi(e.Attr("height"))
+
+		images = append(images, image)
 	})
 
 	// Set error handler
+	notFound := false
 	c.OnError(func(r *colly.Response, err error) {
-		fmt.Println("Request URL:", r.Request.URL, "failed with response:", r, "\nError:", err)
+		if r.StatusCode == http.StatusNotFound {
+			notFound = true
+			return
+		}
+
+		fmt.Fprintln(log, "Request URL:", r.Request.URL, "failed with response:", r, "\nError:", err)
 	})
 
-	err := c.Visit(pageURL)
+	visitErr := c.Visit(pageURL)
+	if notFound {
+		return nil, ErrPageNotFound
+	}
+
+	if visitErr != nil {
+		return nil, fmt.Errorf("visiting: %s", visitErr)
+	}
+
 	if err != nil {
-		return nil, fmt.Errorf("visiting: %s", err)
+		return nil, err
 	}
 
-	return convertToFullSizeURLs(imgURLs)
+	return images, nil
 }
 
-func convertToFullSizeURLs(urls []string) ([]string, error) {
-	var fullSizeURLs []string
-	for _, url := range urls {
-		fullSizeURL, err := getFullSizeVersion(url)
-		if err != nil {
-			return nil, fmt.Errorf("can't get full size version of '%s': %s", url, err)
-		}
-
-		fullSizeURLs = append(fullSizeURLs, fullSizeURL)
+// newImage builds an image from the URL it has in the page
+func newImage(imageURL string) (Image, error) {
+	fullSizeURL, err := getFullSizeVersion(imageURL)
+	if err != nil {
+		return Image{}, fmt.Errorf("can't get full size version of '%s': %s", imageURL, err)
 	}
 
-	return fullSizeURLs, nil
+	// getFullSizeVersion already checked the format
+	parts, _ := imageURLPathParts(imageURL)
+
+	return Image{
+		URL:         fullSizeURL,
+		OriginalURL: imageURL,
+		ID1:         parts[1],
+		ID2:         parts[2],
+		Slug:        parts[3],
+	}, nil
 }
 
 func getFullSizeVersion(imageURL string) (string, error) {
@@ -92,11 +169,9 @@ func getFullSizeVersion(imageURL string) (string, error) {
 		return "", fmt.Errorf("parse: %s", err)
 	}
 
-	// Trim the leading / and split by / to separate the size from the rest of
-	// the path so we can replace it.
-	parts := strings.Split(strings.TrimPrefix(url.Path, "/"), "/")
-	if len(parts) != 4 {
-		return "", errors.New("unexpected path format, expected {size}/{id1}/{id2}/{slug}")
+	parts, err := imageURLPathParts(imageURL)
+	if err != nil {
+		return "", err
 	}
 
 	// Replace size for full and remove the slug
@@ -104,3 +179,21 @@ func getFullSizeVersion(imageURL string) (string, error) {
 
 	return url.String(), nil
 }
+
+// imageURLPathParts splits the path of a Cheezburger image url into
+// {size}/{id1}/{id2}/{slug}
+func imageURLPathParts(imageURL string) ([]string, error) {
+	url, err := url.Parse(imageURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %s", err)
+	}
+
+	// Trim the leading / and split by / to separate the size from the rest of
+	// the path so we can replace it.
+	parts := strings.Split(strings.TrimPrefix(url.Path, "/"), "/")
+	if len(parts) != 4 {
+		return nil, errors.New("unexpected path format, expected {size}/{id1}/{id2}/{slug}")
+	}
+
+	return parts, nil
+}
@@ -0,0 +1,71 @@
+package imgfinder
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Section is the section of the page an image is found in
+type Section string
+
+const (
+	// SectionFeed are the memes posted on their own in the feed
+	SectionFeed Section = "feed"
+	// SectionHot are the thumbnails of the "Hot today" panel, which are
+	// usually posts of the feed too
+	SectionHot Section = "hot"
+	// SectionLists are the covers of list articles, in the feed and in the
+	// featured mosaic at the top
+	SectionLists Section = "lists"
+)
+
+// Sections are all the sections
+var Sections = []Section{SectionFeed, SectionHot, SectionLists}
+
+// ParseSections parses a comma separated list of sections, e.g. feed,hot
+func ParseSections(sections string) ([]Section, error) {
+	var parsed []Section
+	for _, section := range strings.Split(sections, ",") {
+		section = strings.TrimSpace(section)
+		if section == "" {
+			continue
+		}
+
+		if !isSection(Section(section)) {
+			return nil, fmt.Errorf("invalid section '%s', expected feed, hot or lists", section)
+		}
+
+		parsed = append(parsed, Section(section))
+	}
+
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("invalid sections '%s', expected at least one of feed, hot or lists", sections)
+	}
+
+	return parsed, nil
+}
+
+func isSection(section Section) bool {
+	for _, s := range Sections {
+		if s == section {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pageSection returns the section of the page an image is in. Images outside
+// the known sections are considered part of the feed.
+func pageSection(img *goquery.Selection) Section {
+	switch {
+	case img.ParentsFiltered(".mu-hot-today").Length() > 0:
+		return SectionHot
+	case img.ParentsFiltered(".mu-thumbnail, .mu-mosaic").Length() > 0:
+		return SectionLists
+	}
+
+	return SectionFeed
+}
@@ -0,0 +1,71 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagsImagesWithTheirSection(t *testing.T) {
+	images := scrapFixture(t)
+
+	bySection := map[imgfinder.Section][]string{}
+	for _, image := range images {
+		bySection[image.Section] = append(bySection[image.Section], image.URL)
+	}
+
+	assert.Equal(t, []string{
+		"https://i.chzbgr.com/full/9732390400/h07F891DD",
+		"https://i.chzbgr.com/full/9730068224/h8D0C2273",
+		"https://i.chzbgr.com/full/9730292992/h5531A1C8",
+		"https://i.chzbgr.com/full/9730332160/h6860EF7A",
+		"https://i.chzbgr.com/full/9730330624/hEC827B28",
+		"https://i.chzbgr.com/full/9730319616/hBB80CC5F",
+	}, bySection[imgfinder.SectionFeed])
+	assert.Len(t, bySection[imgfinder.SectionHot], 12)
+	assert.Len(t, bySection[imgfinder.SectionLists], 13)
+}
+
+func TestSelectsSections(t *testing.T) {
+	// The hot copy of a meme is saved even if the feed one came first
+	scrapper := MockScrapper{
+		ImagesByPage: map[string][]imgfinder.Image{
+			"https://icanhas.cheezburger.com/": {
+				{URL: "https://i.chzbgr.com/full/1/a", ID1: "1", ID2: "a", Section: imgfinder.SectionFeed},
+				{URL: "https://i.chzbgr.com/full/2/b", ID1: "2", ID2: "b", Section: imgfinder.SectionLists},
+				{URL: "https://i.chzbgr.com/full/1/a", ID1: "1", ID2: "a", Section: imgfinder.SectionHot},
+			},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle("", catscrapertest.Response{Content: []byte("meme"), ContentType: "image/jpeg"})
+	writer := catscrapertest.NewFileSystem()
+
+	finder := imgfinder.New(scrapper, writer, getter).
+		WithFilter(imgfinder.Filter{Sections: []imgfinder.Section{imgfinder.SectionHot}}).
+		WithManifest(true)
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	manifest, err := imgfinder.ReadManifest(writer, "images/")
+	require.NoError(t, err)
+	require.Len(t, manifest.Images, 1)
+	assert.Equal(t, imgfinder.SectionHot, manifest.Images[0].Section)
+}
+
+func TestParseSections(t *testing.T) {
+	sections, err := imgfinder.ParseSections("feed, lists")
+	require.NoError(t, err)
+	assert.Equal(t, []imgfinder.Section{imgfinder.SectionFeed, imgfinder.SectionLists}, sections)
+
+	_, err = imgfinder.ParseSections("feed,ads")
+	require.EqualError(t, err, "invalid section 'ads', expected feed, hot or lists")
+
+	_, err = imgfinder.ParseSections(",")
+	require.EqualError(t, err, "invalid sections ',', expected at least one of feed, hot or lists")
+}
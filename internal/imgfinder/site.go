@@ -0,0 +1,121 @@
+package imgfinder
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Site is a site of the Cheezburger network, which all have the same markup
+type Site struct {
+	// Name is the short name of the site, e.g. icanhas
+	Name string
+	// BaseURL is the URL of the first page of the site, ending in /
+	BaseURL string
+}
+
+// KnownSites are the sites of the Cheezburger network by name
+var KnownSites = map[string]Site{
+	"icanhas":        cheezburgerNetworkSite("icanhas"),
+	"memebase":       cheezburgerNetworkSite("memebase"),
+	"failblog":       cheezburgerNetworkSite("failblog"),
+	"geek":           cheezburgerNetworkSite("geek"),
+	"cheezcake":      cheezburgerNetworkSite("cheezcake"),
+	"animalcomedy":   cheezburgerNetworkSite("animalcomedy"),
+	"loquillo":       cheezburgerNetworkSite("loquillo"),
+	"politicalmemes": cheezburgerNetworkSite("politicalmemes"),
+}
+
+// DefaultSite is the site images are taken from when none is set
+var DefaultSite = KnownSites["icanhas"]
+
+func cheezburgerNetworkSite(name string) Site {
+	return Site{Name: name, BaseURL: fmt.Sprintf("https://%s.cheezburger.com/", name)}
+}
+
+// knownSiteNames returns the names of the known sites, sorted
+func knownSiteNames() []string {
+	var names []string
+	for name := range KnownSites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// ParseSite parses either the name of a known site, e.g. memebase, or the
+// URL of a site with the same markup, e.g. http://localhost:8080
+func ParseSite(site string) (Site, error) {
+	if known, ok := KnownSites[site]; ok {
+		return known, nil
+	}
+
+	parsed, err := url.Parse(site)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return Site{}, fmt.Errorf("invalid site '%s', expected a url or one of %s", site, strings.Join(knownSiteNames(), ", "))
+	}
+
+	// Sites are named after their subdomain, e.g. icanhas.cheezburger.com is
+	// icanhas
+	name := strings.Split(parsed.Hostname(), ".")[0]
+
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/"
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+
+	return Site{Name: name, BaseURL: parsed.String()}, nil
+}
+
+func (s Site) urlForPage(pageNumber int) string {
+	if pageNumber == 1 {
+		return s.BaseURL
+	}
+
+	return fmt.Sprintf("%spage/%d", s.BaseURL, pageNumber)
+}
+
+// A SiteQuota is how many images to take from a site
+type SiteQuota struct {
+	Site   Site
+	Amount int
+}
+
+// ParseSiteQuotas parses a comma separated list of sites with the amount of
+// images to take from each, e.g. icanhas:20,memebase:10. Sites are parsed
+// with ParseSite.
+func ParseSiteQuotas(quotas string) ([]SiteQuota, error) {
+	var parsed []SiteQuota
+	for _, quota := range strings.Split(quotas, ",") {
+		quota = strings.TrimSpace(quota)
+		if quota == "" {
+			continue
+		}
+
+		// Site URLs may have colons, the amount is after the last one
+		separator := strings.LastIndex(quota, ":")
+		if separator == -1 {
+			return nil, fmt.Errorf("invalid site quota '%s', expected site:amount", quota)
+		}
+
+		amount, err := strconv.Atoi(quota[separator+1:])
+		if err != nil || amount <= 0 {
+			return nil, fmt.Errorf("invalid amount in site quota '%s'", quota)
+		}
+
+		site, err := ParseSite(quota[:separator])
+		if err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, SiteQuota{Site: site, Amount: amount})
+	}
+
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("invalid site quotas '%s', expected at least one site:amount", quotas)
+	}
+
+	return parsed, nil
+}
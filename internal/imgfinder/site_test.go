@@ -0,0 +1,102 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollectsFromSeveralSites(t *testing.T) {
+	scrapper := MockScrapper{
+		ImagesByPage: map[string][]imgfinder.Image{
+			"https://icanhas.cheezburger.com/": {
+				{URL: "https://i.chzbgr.com/full/1/a", ID1: "1", ID2: "a"},
+				{URL: "https://i.chzbgr.com/full/2/b", ID1: "2", ID2: "b"},
+			},
+			// Shared with icanhas, so it's only downloaded once
+			"https://memebase.cheezburger.com/": {
+				{URL: "https://i.chzbgr.com/full/2/b", ID1: "2", ID2: "b"},
+			},
+			"https://memebase.cheezburger.com/page/2": {
+				{URL: "https://i.chzbgr.com/full/3/c", ID1: "3", ID2: "c"},
+			},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle("", catscrapertest.Response{Content: []byte("meme"), ContentType: "image/jpeg"})
+	writer := catscrapertest.NewFileSystem()
+
+	namer, err := imgfinder.NewNamer("{{.Site}}/{{.Index}}")
+	require.NoError(t, err)
+
+	finder := imgfinder.New(scrapper, writer, getter).WithNamer(namer)
+
+	err = finder.CollectAndDownloadFromSites([]imgfinder.SiteQuota{
+		{Site: imgfinder.KnownSites["icanhas"], Amount: 2},
+		{Site: imgfinder.KnownSites["memebase"], Amount: 1},
+	}, 2, "images")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{
+		"images/icanhas/1.jpg":  []byte("meme"),
+		"images/icanhas/2.jpg":  []byte("meme"),
+		"images/memebase/3.jpg": []byte("meme"),
+	}, writer.Files())
+	assert.ElementsMatch(t, []string{
+		"https://i.chzbgr.com/full/1/a",
+		"https://i.chzbgr.com/full/2/b",
+		"https://i.chzbgr.com/full/3/c",
+	}, getter.Requests())
+}
+
+func TestCollectsFromConfiguredSite(t *testing.T) {
+	site, err := imgfinder.ParseSite("http://localhost:8080")
+	require.NoError(t, err)
+
+	scrapper := MockScrapper{
+		URLsByPage: map[string][]string{
+			"http://localhost:8080/":       {"https://i.chzbgr.com/full/1/a"},
+			"http://localhost:8080/page/2": {"https://i.chzbgr.com/full/2/b"},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle("", catscrapertest.Response{Content: []byte("meme"), ContentType: "image/jpeg"})
+	writer := catscrapertest.NewFileSystem()
+
+	err = imgfinder.New(scrapper, writer, getter).WithSite(site).CollectAndDownloadImages(2, 1, "images")
+	require.NoError(t, err)
+	assert.Len(t, writer.Files(), 2)
+}
+
+func TestParseSite(t *testing.T) {
+	site, err := imgfinder.ParseSite("failblog")
+	require.NoError(t, err)
+	assert.Equal(t, imgfinder.Site{Name: "failblog", BaseURL: "https://failblog.cheezburger.com/"}, site)
+
+	site, err = imgfinder.ParseSite("https://newsite.cheezburger.com/channel?page=1")
+	require.NoError(t, err)
+	assert.Equal(t, imgfinder.Site{Name: "newsite", BaseURL: "https://newsite.cheezburger.com/channel/"}, site)
+
+	_, err = imgfinder.ParseSite("nope")
+	require.EqualError(t, err, "invalid site 'nope', expected a url or one of animalcomedy, cheezcake, failblog, geek, icanhas, loquillo, memebase, politicalmemes")
+}
+
+func TestParseSiteQuotas(t *testing.T) {
+	quotas, err := imgfinder.ParseSiteQuotas("icanhas:20, http://localhost:8080:5")
+	require.NoError(t, err)
+	assert.Equal(t, []imgfinder.SiteQuota{
+		{Site: imgfinder.KnownSites["icanhas"], Amount: 20},
+		{Site: imgfinder.Site{Name: "localhost", BaseURL: "http://localhost:8080/"}, Amount: 5},
+	}, quotas)
+
+	_, err = imgfinder.ParseSiteQuotas("icanhas")
+	require.EqualError(t, err, "invalid site quota 'icanhas', expected site:amount")
+
+	_, err = imgfinder.ParseSiteQuotas("icanhas:0")
+	require.EqualError(t, err, "invalid amount in site quota 'icanhas:0'")
+}
@@ -0,0 +1,108 @@
+package imgfinder
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+// A Size is the variant of an image to download. Cheezburger serves images
+// scaled to different sizes by changing the first segment of the URL:
+// {size}/{id1}/{id2}.
+type Size string
+
+const (
+	// SizeFull is the original image, and only that
+	SizeFull Size = "full"
+	// SizeLargestAvailable tries the full size first, and then the
+	// thumbnails from the largest to the smallest. It's the default.
+	SizeLargestAvailable Size = "largest-available"
+)
+
+// standardThumbnailWidths are the thumbnail sizes the site uses, which are the
+// fallbacks when a size is not found.
+var standardThumbnailWidths = []int{1200, 800, 400}
+
+var thumbnailSize = regexp.MustCompile(`^thumb([1-9][0-9]*)$`)
+
+// ParseSize parses full, largest-available or thumbN where N is the width
+func ParseSize(size string) (Size, error) {
+	if Size(size) == SizeFull || Size(size) == SizeLargestAvailable || thumbnailSize.MatchString(size) {
+		return Size(size), nil
+	}
+
+	return "", fmt.Errorf("invalid size '%s', expected full, thumbN (e.g. thumb800) or largest-available", size)
+}
+
+// fallbackChain returns the URL segments of the sizes to try in order, until
+// one isn't a 404 Not Found. A thumbnail falls back to the standard
+// thumbnails that are smaller, and the full size doesn't fall back.
+func (s Size) fallbackChain() []string {
+	if s == SizeLargestAvailable {
+		chain := []string{string(SizeFull)}
+		for _, width := range standardThumbnailWidths {
+			chain = append(chain, fmt.Sprintf("thumb%d", width))
+		}
+
+		return chain
+	}
+
+	match := thumbnailSize.FindStringSubmatch(string(s))
+	if match == nil {
+		return []string{string(s)}
+	}
+
+	chain := []string{string(s)}
+	width, _ := strconv.Atoi(match[1])
+	for _, standardWidth := range standardThumbnailWidths {
+		if standardWidth < width {
+			chain = append(chain, fmt.Sprintf("thumb%d", standardWidth))
+		}
+	}
+
+	return chain
+}
+
+// urlForSize returns the URL of the image with the given size segment.
+// Images without ids can't be resized, so their URL is kept as it is.
+func (i Image) urlForSize(size string) string {
+	if i.ID1 == "" || i.ID2 == "" {
+		return i.URL
+	}
+
+	sized, err := url.Parse(i.URL)
+	if err != nil {
+		return i.URL
+	}
+
+	sized.Path = fmt.Sprintf("%s/%s/%s", size, i.ID1, i.ID2)
+	return sized.String()
+}
+
+// getImage GETs the image in the size of the finder, falling back to the
+// next size in the chain when it's not found. It returns the response along
+// with the URL it's from.
+func (f Finder) getImage(image Image) (*http.Response, string, error) {
+	chain := f.size.fallbackChain()
+
+	for i, size := range chain {
+		url := image.urlForSize(size)
+
+		resp, err := f.getter.Get(url)
+		if err != nil {
+			return nil, "", fmt.Errorf("get: %s", err)
+		}
+
+		if resp.StatusCode == http.StatusNotFound && i < len(chain)-1 {
+			resp.Body.Close()
+			fmt.Fprintf(f.log, "Image %s not found, trying %s\n", url, chain[i+1])
+			continue
+		}
+
+		return resp, url, nil
+	}
+
+	return nil, "", fmt.Errorf("no sizes to try for %s", image.URL)
+}
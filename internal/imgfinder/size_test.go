@@ -0,0 +1,115 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sizedImage = imgfinder.Image{
+	URL: "https://i.chzbgr.com/full/9730332160/h6860EF7A",
+	ID1: "9730332160",
+	ID2: "h6860EF7A",
+}
+
+func newSizeFinder(images ...imgfinder.Image) (imgfinder.Finder, *catscrapertest.FileSystem, *catscrapertest.Getter) {
+	scrapper := MockScrapper{
+		ImagesByPage: map[string][]imgfinder.Image{
+			"https://icanhas.cheezburger.com/": images,
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	// Every other size is not found
+	getter.Handle("", catscrapertest.Response{StatusCode: http.StatusNotFound})
+
+	writer := catscrapertest.NewFileSystem()
+
+	return imgfinder.New(scrapper, writer, getter), writer, getter
+}
+
+func TestDownloadsSelectedSize(t *testing.T) {
+	finder, writer, getter := newSizeFinder(sizedImage)
+	getter.Handle("https://i.chzbgr.com/thumb400/9730332160/h6860EF7A", catscrapertest.Response{Content: []byte("small"), ContentType: "image/png"})
+
+	size, err := imgfinder.ParseSize("thumb400")
+	require.NoError(t, err)
+
+	err = finder.WithSize(size).CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{"images/1.png": []byte("small")}, writer.Files())
+	assert.Equal(t, []string{"https://i.chzbgr.com/thumb400/9730332160/h6860EF7A"}, getter.Requests())
+}
+
+func TestLargestAvailableFallsBackOnNotFound(t *testing.T) {
+	finder, writer, getter := newSizeFinder(sizedImage)
+	getter.Handle("https://i.chzbgr.com/thumb800/9730332160/h6860EF7A", catscrapertest.Response{Content: []byte("medium"), ContentType: "image/jpeg"})
+
+	// Largest available is the default
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{"images/1.jpg": []byte("medium")}, writer.Files())
+	assert.Equal(t, []string{
+		"https://i.chzbgr.com/full/9730332160/h6860EF7A",
+		"https://i.chzbgr.com/thumb1200/9730332160/h6860EF7A",
+		"https://i.chzbgr.com/thumb800/9730332160/h6860EF7A",
+	}, getter.Requests())
+}
+
+func TestThumbnailFallsBackToSmallerThumbnails(t *testing.T) {
+	finder, _, getter := newSizeFinder(sizedImage)
+
+	err := finder.WithSize("thumb1000").CollectAndDownloadImages(1, 1, "images/")
+	require.EqualError(t, err, "downloading images: downloading image https://i.chzbgr.com/full/9730332160/h6860EF7A: unexpected status code '404' expected 200 OK")
+
+	assert.Equal(t, []string{
+		"https://i.chzbgr.com/thumb1000/9730332160/h6860EF7A",
+		"https://i.chzbgr.com/thumb800/9730332160/h6860EF7A",
+		"https://i.chzbgr.com/thumb400/9730332160/h6860EF7A",
+	}, getter.Requests())
+}
+
+func TestFullSizeDoesNotFallBack(t *testing.T) {
+	finder, _, getter := newSizeFinder(sizedImage)
+
+	err := finder.WithSize(imgfinder.SizeFull).CollectAndDownloadImages(1, 1, "images/")
+	require.EqualError(t, err, "downloading images: downloading image https://i.chzbgr.com/full/9730332160/h6860EF7A: unexpected status code '404' expected 200 OK")
+
+	assert.Equal(t, []string{"https://i.chzbgr.com/full/9730332160/h6860EF7A"}, getter.Requests())
+}
+
+func TestDeduplicatesByIDsRegardlessOfSize(t *testing.T) {
+	thumbnail := sizedImage
+	thumbnail.OriginalURL = "https://i.chzbgr.com/thumb400/9730332160/h6860EF7A/just-no"
+
+	other := imgfinder.Image{URL: "https://i.chzbgr.com/full/2/h2", ID1: "2", ID2: "h2"}
+
+	finder, writer, getter := newSizeFinder(sizedImage, thumbnail, other)
+	getter.Handle("https://i.chzbgr.com/thumb800/9730332160/h6860EF7A", catscrapertest.Response{Content: []byte("1"), ContentType: "image/jpeg"})
+	getter.Handle("https://i.chzbgr.com/thumb800/2/h2", catscrapertest.Response{Content: []byte("2"), ContentType: "image/jpeg"})
+
+	err := finder.WithSize("thumb800").CollectAndDownloadImages(2, 1, "images/")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{
+		"images/1.jpg": []byte("1"),
+		"images/2.jpg": []byte("2"),
+	}, writer.Files())
+}
+
+func TestParseSize(t *testing.T) {
+	for _, valid := range []string{"full", "largest-available", "thumb800", "thumb1200"} {
+		size, err := imgfinder.ParseSize(valid)
+		require.NoError(t, err)
+		assert.Equal(t, imgfinder.Size(valid), size)
+	}
+
+	_, err := imgfinder.ParseSize("thumb")
+	require.EqualError(t, err, "invalid size 'thumb', expected full, thumbN (e.g. thumb800) or largest-available")
+}
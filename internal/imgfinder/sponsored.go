@@ -0,0 +1,68 @@
+package imgfinder
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultImageHosts are the CDN hosts Cheezburger serves memes from
+var DefaultImageHosts = []string{"i.chzbgr.com"}
+
+// adContainerSelector matches the containers of ads and sponsored content.
+// Ad units may reuse the classes of memes, so images inside them are never
+// memes.
+const adContainerSelector = `.mu-ad-container, .mu-ad, .OUTBRAIN, .ob-widget, ` +
+	`[class*="sponsor"], [class*="promoted"], [id*="sponsor"], [data-sponsored], [data-ad]`
+
+// postSelector matches the card of a single post or tile, which has its
+// labels. Panels like "hot today" are cards too, so their tiles are matched
+// one by one instead.
+const postSelector = `.js-post, .mu-mosaic > .mu-card, .mu-items > a`
+
+// sponsoredLabel matches the text of labels that mark sponsored posts
+var sponsoredLabel = regexp.MustCompile(`(?i)^(sponsored|promoted|paid (content|post|partnership)|advertisement)( by .+)?$`)
+
+// isSponsored is whether an image is an ad or part of sponsored content,
+// either by being in an ad container or in a post labeled as sponsored
+func isSponsored(img *goquery.Selection) bool {
+	if img.ParentsFiltered(adContainerSelector).Length() > 0 {
+		return true
+	}
+
+	post := img.Closest(postSelector)
+	if post.Length() == 0 {
+		return false
+	}
+
+	sponsored := false
+	post.Find("*").EachWithBreak(func(_ int, element *goquery.Selection) bool {
+		// Only the elements with text of their own are labels
+		if element.Children().Length() > 0 {
+			return true
+		}
+
+		sponsored = sponsoredLabel.MatchString(strings.TrimSpace(element.Text()))
+		return !sponsored
+	})
+
+	return sponsored
+}
+
+// allowedHost is whether an image URL is served from one of hosts
+func allowedHost(imageURL string, hosts []string) bool {
+	parsed, err := url.Parse(imageURL)
+	if err != nil {
+		return false
+	}
+
+	for _, host := range hosts {
+		if strings.EqualFold(parsed.Hostname(), host) {
+			return true
+		}
+	}
+
+	return false
+}
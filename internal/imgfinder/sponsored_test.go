@@ -0,0 +1,118 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixtureSite serves the saved Cheezburger homepage, with replacements applied
+// in pairs of old and new strings.
+// Injected strings are marked with <!-- injected --> to check they are applied.
+func fixtureSite(t *testing.T, replacements ...string) *catscrapertest.Site {
+	source, err := os.ReadFile("testdata/cheezburger-source.html")
+	require.NoError(t, err)
+
+	page := strings.NewReplacer(replacements...).Replace(string(source))
+	if len(replacements) > 0 {
+		require.Contains(t, page, "<!-- injected -->", "the replacements are applied")
+	}
+
+	site := catscrapertest.NewSite()
+	site.Handle("/", catscrapertest.Response{ContentType: "text/html", Content: []byte(page)})
+	t.Cleanup(site.Close)
+
+	return site
+}
+
+func scrapFixture(t *testing.T, replacements ...string) []imgfinder.Image {
+	images, err := imgfinder.CheezburgerScrapper{}.CollectImagesFrom(fixtureSite(t, replacements...).URL)
+	require.NoError(t, err)
+
+	return images
+}
+
+func TestScrapsMemesFromSavedPage(t *testing.T) {
+	images := scrapFixture(t)
+
+	assert.Len(t, images, 31)
+	assert.Contains(t, imageURLs(images), "https://i.chzbgr.com/full/9732390400/h07F891DD")
+	assert.Contains(t, imageURLs(images), "https://i.chzbgr.com/full/9730332160/h6860EF7A")
+}
+
+func TestSkipsImagesInAdContainers(t *testing.T) {
+	images := scrapFixture(t,
+		`<div class="mu-ad" id="mu-stream-ad-1" data-responsive-size="[[[1100,0],&quot;wideincontent&quot;],[[0,0],&quot;medrec&quot;]]"></div>`,
+		`<div class="mu-ad" id="mu-stream-ad-1"><!-- injected --><img class="resp-media" src="https://i.chzbgr.com/full/1/hAD/buy-cat-food" width="300" height="250"/></div>`,
+	)
+
+	assert.Equal(t, imageURLs(scrapFixture(t)), imageURLs(images))
+}
+
+func TestSkipsPostsLabeledAsSponsored(t *testing.T) {
+	images := scrapFixture(t,
+		`<div class="mu-post-title mu-section mu-inset">
+        <h1>
+            <a href="https://cheezburger.com/9732390400/burn"`,
+		`<div class="mu-post-label"><!-- injected --><span>Sponsored</span></div>
+    <div class="mu-post-title mu-section mu-inset">
+        <h1>
+            <a href="https://cheezburger.com/9732390400/burn"`,
+	)
+
+	assert.NotContains(t, imageURLs(images), "https://i.chzbgr.com/full/9732390400/h07F891DD")
+	assert.Len(t, images, 30)
+}
+
+func TestSkipsOnlyTheSponsoredHotTodayTiles(t *testing.T) {
+	// The first tile of both tabs of the panel is labeled
+	images := scrapFixture(t,
+		`Hissterical (Video)
+                                <span>1</span>`,
+		`Hissterical (Video)
+                                <span>1</span><!-- injected --><span>Sponsored</span>`,
+	)
+
+	count := func(images []imgfinder.Image, url string) int {
+		n := 0
+		for _, image := range imageURLs(images) {
+			if image == url {
+				n++
+			}
+		}
+		return n
+	}
+
+	// The copy in the feed isn't labeled, and the other tiles are organic
+	sponsored := "https://i.chzbgr.com/full/3749638/h1C7C74B7"
+	organic := "https://i.chzbgr.com/full/19218949/hA2BD07D2"
+	assert.Equal(t, 3, count(scrapFixture(t), sponsored))
+	assert.Equal(t, 1, count(images, sponsored))
+	assert.Equal(t, 2, count(images, organic))
+	assert.Len(t, images, 29)
+}
+
+func TestSkipsImagesFromOtherHosts(t *testing.T) {
+	images := scrapFixture(t,
+		`<div class="ad-label">Advertisement</div>`,
+		`<div class="ad-label">Advertisement</div><!-- injected --><img class="resp-media" src="https://tpc.googlesyndication.com/simgad/1/2/ad.jpg"/>`,
+	)
+
+	assert.Equal(t, imageURLs(scrapFixture(t)), imageURLs(images))
+}
+
+func TestAllowedImageHosts(t *testing.T) {
+	site := NewTestServer(
+		`<img class="resp-media" src="https://cdn.example.com/full/1/hA/meme"/>`,
+		`<img class="resp-media" src="https://i.chzbgr.com/full/2/hB/meme"/>`,
+	)
+
+	images, err := imgfinder.CheezburgerScrapper{ImageHosts: []string{"cdn.example.com"}}.CollectImagesFrom(site.URL)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://cdn.example.com/full/1/hA"}, imageURLs(images))
+}
@@ -0,0 +1,244 @@
+package imgfinder
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	stddraw "image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// GIFThumbnailMode is how thumbnails of animated GIFs are generated
+type GIFThumbnailMode string
+
+const (
+	// GIFFirstFrame makes a still thumbnail from the first frame
+	GIFFirstFrame GIFThumbnailMode = "first-frame"
+	// GIFAllFrames resizes every frame, keeping the animation
+	GIFAllFrames GIFThumbnailMode = "all-frames"
+)
+
+func ParseGIFThumbnailMode(mode string) (GIFThumbnailMode, error) {
+	switch GIFThumbnailMode(mode) {
+	case GIFFirstFrame, GIFAllFrames:
+		return GIFThumbnailMode(mode), nil
+	}
+
+	return "", fmt.Errorf("invalid gif thumbnail mode '%s', expected first-frame or all-frames", mode)
+}
+
+// Thumbnails configures the resized variants generated for every saved image
+type Thumbnails struct {
+	// Widths of the thumbnails. The height keeps the aspect ratio. Images are
+	// never enlarged, so widths bigger than the image are skipped.
+	Widths []int
+	GIF    GIFThumbnailMode
+}
+
+// ParseThumbnailWidths parses a comma separated list of widths, e.g. 200,800
+func ParseThumbnailWidths(widths string) ([]int, error) {
+	var parsed []int
+	for _, width := range strings.Split(widths, ",") {
+		width = strings.TrimSpace(width)
+		if width == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(width)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid thumbnail width '%s'", width)
+		}
+
+		parsed = append(parsed, n)
+	}
+	sort.Ints(parsed)
+
+	return parsed, nil
+}
+
+// thumbnailPath is where the thumbnail of the given width of the image saved
+// at path goes, e.g. images/1.jpg has images/1.thumb200.jpg
+func thumbnailPath(path string, width int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s.thumb%d%s", strings.TrimSuffix(path, ext), width, ext)
+}
+
+// saveThumbnails generates and saves the thumbnails of an image saved at path,
+// in the same format. It returns the paths of the thumbnails.
+func (f Finder) saveThumbnails(path string, data []byte) ([]string, error) {
+	if len(f.thumbnails.Widths) == 0 {
+		return nil, nil
+	}
+
+	ext := filepath.Ext(path)
+	thumbnails, err := makeThumbnails(data, ext, f.thumbnails)
+	if err != nil {
+		return nil, fmt.Errorf("generating thumbnails: %s", err)
+	}
+
+	var paths []string
+	for _, width := range f.thumbnails.Widths {
+		thumbnail, ok := thumbnails[width]
+		if !ok {
+			continue
+		}
+
+		err := f.fileSystem.WriteFile(thumbnailPath(path, width), thumbnail, 0777)
+		if err != nil {
+			return nil, fmt.Errorf("saving thumbnail: %s", err)
+		}
+
+		paths = append(paths, thumbnailPath(path, width))
+	}
+
+	return paths, nil
+}
+
+// makeThumbnails returns the encoded thumbnails by width
+func makeThumbnails(data []byte, ext string, config Thumbnails) (map[int][]byte, error) {
+	if ext == ".gif" && config.GIF == GIFAllFrames {
+		return makeAnimatedThumbnails(data, config.Widths)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding: %s", err)
+	}
+
+	thumbnails := map[int][]byte{}
+	for _, width := range config.Widths {
+		if width >= img.Bounds().Dx() {
+			continue
+		}
+
+		encoded, err := encodeImage(resize(img, width), ext)
+		if err != nil {
+			return nil, fmt.Errorf("encoding: %s", err)
+		}
+
+		thumbnails[width] = encoded
+	}
+
+	return thumbnails, nil
+}
+
+func makeAnimatedThumbnails(data []byte, widths []int) (map[int][]byte, error) {
+	animation, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decoding: %s", err)
+	}
+
+	frames := compositeFrames(animation)
+
+	thumbnails := map[int][]byte{}
+	for _, width := range widths {
+		if width >= animation.Config.Width {
+			continue
+		}
+
+		resized := &gif.GIF{
+			Delay:     animation.Delay,
+			LoopCount: animation.LoopCount,
+		}
+
+		for i, frame := range frames {
+			scaled := resize(frame, width)
+
+			// Scaling blends colors, so they are dithered back into the
+			// original palette of the frame.
+			paletted := image.NewPaletted(scaled.Bounds(), animation.Image[i].Palette)
+			stddraw.FloydSteinberg.Draw(paletted, paletted.Bounds(), scaled, image.Point{})
+
+			resized.Image = append(resized.Image, paletted)
+			resized.Disposal = append(resized.Disposal, gif.DisposalNone)
+		}
+
+		var encoded bytes.Buffer
+		err := gif.EncodeAll(&encoded, resized)
+		if err != nil {
+			return nil, fmt.Errorf("encoding: %s", err)
+		}
+
+		thumbnails[width] = encoded.Bytes()
+	}
+
+	return thumbnails, nil
+}
+
+// compositeFrames renders every frame of an animation as it's shown. GIF
+// frames may only have the part of the image that changes, and how they are
+// cleared depends on their disposal method.
+func compositeFrames(animation *gif.GIF) []image.Image {
+	bounds := image.Rect(0, 0, animation.Config.Width, animation.Config.Height)
+	canvas := image.NewRGBA(bounds)
+
+	var frames []image.Image
+	for i, frame := range animation.Image {
+		var previous *image.RGBA
+		disposal := byte(gif.DisposalNone)
+		if i < len(animation.Disposal) {
+			disposal = animation.Disposal[i]
+		}
+
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			stddraw.Draw(previous, bounds, canvas, image.Point{}, stddraw.Src)
+		}
+
+		stddraw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, stddraw.Over)
+
+		rendered := image.NewRGBA(bounds)
+		stddraw.Draw(rendered, bounds, canvas, image.Point{}, stddraw.Src)
+		frames = append(frames, rendered)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			stddraw.Draw(canvas, frame.Bounds(), image.NewUniform(color.Transparent), image.Point{}, stddraw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return frames
+}
+
+// resize scales an image to the given width keeping the aspect ratio
+func resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := (bounds.Dy()*width + bounds.Dx()/2) / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+
+	return resized
+}
+
+func encodeImage(img image.Image, ext string) ([]byte, error) {
+	var encoded bytes.Buffer
+	var err error
+
+	switch ext {
+	case ".jpg":
+		err = jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 85})
+	case ".png":
+		err = png.Encode(&encoded, img)
+	case ".gif":
+		err = gif.Encode(&encoded, img, nil)
+	default:
+		err = fmt.Errorf("unexpected extension '%s'", ext)
+	}
+
+	return encoded.Bytes(), err
+}
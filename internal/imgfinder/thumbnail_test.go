@@ -0,0 +1,138 @@
+package imgfinder_test
+
+import (
+	"bytes"
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newThumbnailFinder(content []byte, contentType string) (imgfinder.Finder, *catscrapertest.FileSystem) {
+	const url = "https://i.chzbgr.com/full/9730332160/h6860EF7A"
+
+	scrapper := MockScrapper{
+		URLsByPage: map[string][]string{
+			"https://icanhas.cheezburger.com/": {url},
+		},
+	}
+
+	getter := catscrapertest.NewGetter()
+	getter.Handle(url, catscrapertest.Response{Content: content, ContentType: contentType, StatusCode: http.StatusOK})
+
+	writer := catscrapertest.NewFileSystem()
+
+	return imgfinder.New(scrapper, writer, getter), writer
+}
+
+func TestSavesThumbnailsKeepingAspectRatio(t *testing.T) {
+	var original bytes.Buffer
+	require.NoError(t, jpeg.Encode(&original, image.NewRGBA(image.Rect(0, 0, 400, 200)), nil))
+
+	finder, writer := newThumbnailFinder(original.Bytes(), "image/jpeg")
+	finder = finder.WithThumbnails(imgfinder.Thumbnails{Widths: []int{100, 800}})
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	files := writer.Files()
+	assert.Equal(t, original.Bytes(), files["images/1.jpg"])
+	assert.Len(t, files, 2, "images are not enlarged")
+
+	thumbnail, err := jpeg.Decode(bytes.NewReader(files["images/1.thumb100.jpg"]))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 100, 50), thumbnail.Bounds())
+}
+
+func TestThumbnailsKeepFormat(t *testing.T) {
+	var original bytes.Buffer
+	require.NoError(t, png.Encode(&original, image.NewRGBA(image.Rect(0, 0, 30, 90))))
+
+	finder, writer := newThumbnailFinder(original.Bytes(), "image/png")
+	finder = finder.WithThumbnails(imgfinder.Thumbnails{Widths: []int{10}})
+
+	err := finder.CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	thumbnail, err := png.Decode(bytes.NewReader(writer.Files()["images/1.thumb10.png"]))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 10, 30), thumbnail.Bounds())
+}
+
+func TestAnimatedGIFThumbnails(t *testing.T) {
+	original := animatedGIF(t, 40, 20, 3)
+
+	finder, writer := newThumbnailFinder(original, "image/gif")
+	err := finder.WithThumbnails(imgfinder.Thumbnails{Widths: []int{20}, GIF: imgfinder.GIFAllFrames}).
+		CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	thumbnail, err := gif.DecodeAll(bytes.NewReader(writer.Files()["images/1.thumb20.gif"]))
+	require.NoError(t, err)
+	require.Len(t, thumbnail.Image, 3)
+	assert.Equal(t, []int{10, 20, 30}, thumbnail.Delay)
+	for _, frame := range thumbnail.Image {
+		assert.Equal(t, image.Rect(0, 0, 20, 10), frame.Bounds())
+	}
+
+	finder, writer = newThumbnailFinder(original, "image/gif")
+	err = finder.WithThumbnails(imgfinder.Thumbnails{Widths: []int{20}, GIF: imgfinder.GIFFirstFrame}).
+		CollectAndDownloadImages(1, 1, "images/")
+	require.NoError(t, err)
+
+	thumbnail, err = gif.DecodeAll(bytes.NewReader(writer.Files()["images/1.thumb20.gif"]))
+	require.NoError(t, err)
+	assert.Len(t, thumbnail.Image, 1)
+}
+
+func TestThumbnailOfInvalidImage(t *testing.T) {
+	finder, _ := newThumbnailFinder([]byte("not an image"), "image/jpeg")
+
+	err := finder.WithThumbnails(imgfinder.Thumbnails{Widths: []int{100}}).CollectAndDownloadImages(1, 1, "images/")
+	require.EqualError(t, err, "downloading images: downloading image https://i.chzbgr.com/full/9730332160/h6860EF7A: generating thumbnails: decoding: image: unknown format")
+}
+
+func TestParseThumbnailWidths(t *testing.T) {
+	widths, err := imgfinder.ParseThumbnailWidths("800, 200")
+	require.NoError(t, err)
+	assert.Equal(t, []int{200, 800}, widths)
+
+	_, err = imgfinder.ParseThumbnailWidths("200,big")
+	require.EqualError(t, err, "invalid thumbnail width 'big'")
+}
+
+// animatedGIF encodes a GIF with the given amount of frames, where every frame
+// but the first only has the part of the image that changes.
+func animatedGIF(t *testing.T, width int, height int, frames int) []byte {
+	animation := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		bounds := image.Rect(0, 0, width, height)
+		if i > 0 {
+			bounds = image.Rect(i, i, width/2, height/2)
+		}
+
+		frame := image.NewPaletted(bounds, palette.Plan9)
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				frame.Set(x, y, color.RGBA{R: uint8(i * 100), G: 50, B: 50, A: 255})
+			}
+		}
+
+		animation.Image = append(animation.Image, frame)
+		animation.Delay = append(animation.Delay, (i+1)*10)
+	}
+
+	var encoded bytes.Buffer
+	require.NoError(t, gif.EncodeAll(&encoded, animation))
+
+	return encoded.Bytes()
+}
@@ -0,0 +1,127 @@
+package imgfinder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// An ImageRef is an image as it's listed by a dry run, one JSON object per
+// line. Image lists can be read back with ReadImageList.
+type ImageRef struct {
+	Index       int    `json:"index"`
+	URL         string `json:"url"`
+	OriginalURL string `json:"original_url"`
+	Title       string `json:"title"`
+	Alt         string `json:"alt"`
+	Section     string `json:"section"`
+	// Filename is where the image would be saved, relative to the images
+	// directory, with / separators
+	Filename string `json:"filename"`
+}
+
+// Ref returns how the planned image is listed
+func (p PlannedImage) Ref() ImageRef {
+	return ImageRef{
+		Index:       p.Index,
+		URL:         p.URL,
+		OriginalURL: p.OriginalURL,
+		Title:       p.Title,
+		Alt:         p.Alt,
+		Section:     string(p.Section),
+		Filename:    filepath.ToSlash(p.Path),
+	}
+}
+
+// ReadImageList reads the images of a list with one image per line, either a
+// Cheezburger image URL or an ImageRef. Empty lines and lines starting with #
+// are skipped. URLs are normalized to their full size version like scrapped
+// ones, and images listed more than once are only returned once.
+func (f Finder) ReadImageList(r io.Reader) ([]Image, error) {
+	seen := map[string]bool{}
+
+	var images []Image
+	duplicates := 0
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		image, err := listedImage(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+
+		if seen[image.Key()] {
+			duplicates++
+			continue
+		}
+		seen[image.Key()] = true
+
+		images = append(images, image)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading image list: %s", err)
+	}
+
+	fmt.Fprintf(f.log, "Read %d images (%d duplicates)\n", len(images)+duplicates, duplicates)
+
+	return images, nil
+}
+
+// listedImage builds an image from a line of an image list
+func listedImage(line string) (Image, error) {
+	if !strings.HasPrefix(line, "{") {
+		return listedImageURL(line)
+	}
+
+	var ref ImageRef
+	err := json.Unmarshal([]byte(line), &ref)
+	if err != nil {
+		return Image{}, fmt.Errorf("invalid image ref: %s", err)
+	}
+
+	// The original URL has the slug, which the full size one doesn't
+	imageURL := ref.OriginalURL
+	if imageURL == "" {
+		imageURL = ref.URL
+	}
+
+	if imageURL == "" {
+		return Image{}, fmt.Errorf("image ref without url")
+	}
+
+	image, err := listedImageURL(imageURL)
+	if err != nil {
+		return Image{}, err
+	}
+
+	image.Title = ref.Title
+	image.Alt = ref.Alt
+	image.Section = Section(ref.Section)
+
+	return image, nil
+}
+
+// listedImageURL builds an image from its URL. Full size URLs, which have no
+// slug, are accepted too, as that's how images are listed.
+func listedImageURL(imageURL string) (Image, error) {
+	withSlug := imageURL
+	if parts, err := imageURLPathParts(imageURL + "/"); err == nil && parts[3] == "" {
+		withSlug = imageURL + "/"
+	}
+
+	image, err := newImage(withSlug)
+	if err != nil {
+		return Image{}, err
+	}
+
+	image.OriginalURL = imageURL
+	return image, nil
+}
@@ -0,0 +1,64 @@
+package imgfinder_test
+
+import (
+	"cat-scraper/catscraper/catscrapertest"
+	"cat-scraper/internal/imgfinder"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadsImageList(t *testing.T) {
+	finder := imgfinder.New(MockScrapper{}, catscrapertest.NewFileSystem(), catscrapertest.NewGetter()).WithLog(io.Discard)
+
+	list := `# memes from the last run
+https://i.chzbgr.com/thumb800/1/h1/first
+
+https://i.chzbgr.com/full/2/h2
+{"index":1,"url":"https://i.chzbgr.com/full/3/h3","original_url":"https://i.chzbgr.com/thumb400/3/h3/third","title":"Third","alt":"A cat","section":"hot"}
+https://i.chzbgr.com/full/1/h1/first-again
+{"url":"https://i.chzbgr.com/full/2/h2"}
+`
+
+	images, err := finder.ReadImageList(strings.NewReader(list))
+	require.NoError(t, err)
+
+	assert.Equal(t, []imgfinder.Image{
+		{
+			URL:         "https://i.chzbgr.com/full/1/h1",
+			OriginalURL: "https://i.chzbgr.com/thumb800/1/h1/first",
+			ID1:         "1",
+			ID2:         "h1",
+			Slug:        "first",
+		},
+		{
+			URL:         "https://i.chzbgr.com/full/2/h2",
+			OriginalURL: "https://i.chzbgr.com/full/2/h2",
+			ID1:         "2",
+			ID2:         "h2",
+		},
+		{
+			URL:         "https://i.chzbgr.com/full/3/h3",
+			OriginalURL: "https://i.chzbgr.com/thumb400/3/h3/third",
+			ID1:         "3",
+			ID2:         "h3",
+			Slug:        "third",
+			Title:       "Third",
+			Alt:         "A cat",
+			Section:     imgfinder.SectionHot,
+		},
+	}, images)
+}
+
+func TestRejectsInvalidImageList(t *testing.T) {
+	finder := imgfinder.New(MockScrapper{}, catscrapertest.NewFileSystem(), catscrapertest.NewGetter()).WithLog(io.Discard)
+
+	_, err := finder.ReadImageList(strings.NewReader("https://i.chzbgr.com/full/1/h1\nhttps://example.com/cat.jpg\n"))
+	require.EqualError(t, err, "line 2: can't get full size version of 'https://example.com/cat.jpg': unexpected path format, expected {size}/{id1}/{id2}/{slug}")
+
+	_, err = finder.ReadImageList(strings.NewReader(`{"title":"No URL"}`))
+	require.EqualError(t, err, "line 1: image ref without url")
+}
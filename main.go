@@ -5,6 +5,7 @@ import (
 	"cat-scraper/internal/imgfinder"
 	"log"
 	"net/http"
+	"os"
 )
 
 func main() {
@@ -14,7 +15,7 @@ func main() {
 		http.DefaultClient,
 	)
 
-	err := cli.Run(finder)
+	err := cli.Run(finder, os.Args[1:], os.LookupEnv, os.Stdout, os.Stderr)
 	if err != nil {
 		log.Fatal(err)
 	}